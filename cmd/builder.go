@@ -102,6 +102,9 @@ func (b *DockerBuilder) Build(ctx context.Context, env *util.Environment, config
 	if err != nil {
 		return nil, nil, err
 	}
+	if shared == nil {
+		return nil, nil, fmt.Errorf("Service pipeline %s can not use a matrix", newOptions.Pipeline)
+	}
 	// TODO(termie): this causes the ID to get overwritten but
 	//               we want the shortname that the user specified as an ID
 	//               so we probably wnat to make a copy or something here
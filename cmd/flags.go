@@ -155,6 +155,60 @@ var (
 		cli.BoolFlag{Name: "workflows-in-yml", Usage: "Use ephemeral checkout pipeline", Hidden: true},
 	}
 
+	// Flags for running pipelines with a matrix
+	MatrixFlags = []cli.Flag{
+		cli.BoolFlag{Name: "matrix-parallel", Usage: "Run the expansions of a pipeline matrix in parallel."},
+	}
+
+	// Flags for running workflows
+	WorkflowFlags = []cli.Flag{
+		cli.IntFlag{Name: "max-parallel", Value: 4, Usage: "Maximum number of workflow pipelines to run at the same time, 0 for no limit."},
+		cli.BoolFlag{Name: "keep-going", Usage: "Let the other pipelines of the workflow finish when a pipeline fails, instead of cancelling them."},
+		cli.StringFlag{Name: "resume", Usage: "ID of a workflow run to resume, the pipelines that passed in it are not run again."},
+		cli.BoolFlag{Name: "plan", Usage: "Print what the workflow would run without running it."},
+		cli.BoolFlag{Name: "auto-approve", Usage: "Run the workflow pipelines that need approval without asking."},
+		cli.BoolFlag{Name: "stop-at-approval", Usage: "Stop the workflow before the pipelines that need approval instead of asking, resume the run to approve them."},
+		cli.StringFlag{Name: "base-ref", Usage: "Git ref to compare the project to for the path filters of the workflow pipelines, only uncommitted changes count by default."},
+	}
+
+	// Flags for workflow graph
+	WorkflowGraphFlags = []cli.Flag{
+		cli.StringFlag{Name: "format", Value: "dot", Usage: "Format of the graph: dot, mermaid or json."},
+	}
+
+	// Flags for runs list
+	RunsListFlags = []cli.Flag{
+		cli.StringFlag{Name: "pipeline", Usage: "Only list the runs of this pipeline."},
+		cli.StringFlag{Name: "branch", Usage: "Only list the runs on this git branch."},
+		cli.StringFlag{Name: "result", Usage: "Only list the runs with this result: passed, failed or running."},
+		cli.IntFlag{Name: "limit", Value: 20, Usage: "Maximum number of runs to list, 0 for all of them."},
+	}
+
+	// Flags for runs show
+	RunsShowFlags = []cli.Flag{
+		cli.BoolFlag{Name: "logs", Usage: "Print the logs of the run."},
+	}
+
+	// Flags for logs
+	LogsFlags = []cli.Flag{
+		cli.StringFlag{Name: "step", Usage: "Only show the logs of the steps with this name."},
+		cli.StringFlag{Name: "stream", Usage: "Only show the logs of this stream: stdout, stderr or stdin."},
+		cli.StringFlag{Name: "grep", Usage: "Only show the lines matching this regular expression."},
+		cli.BoolFlag{Name: "follow, f", Usage: "Keep showing the logs until the run finishes."},
+	}
+
+	// Flags for check-config
+	CheckConfigFlags = []cli.Flag{
+		cli.BoolFlag{Name: "strict", Usage: "Validate the wercker.yml against its schema and report every problem."},
+		cli.BoolFlag{Name: "schema", Usage: "Print the JSON Schema for wercker.yml and exit."},
+	}
+
+	// Flags for fmt
+	FormatFlags = []cli.Flag{
+		cli.StringFlag{Name: "wercker-yml", Value: "", Usage: "Specify a specific yaml file.", EnvVar: "WERCKER_YML_FILE"},
+		cli.BoolFlag{Name: "write", Usage: "Write the result to the wercker.yml instead of printing a diff."},
+	}
+
 	// Flags for advanced deploy settings
 	InternalDeployFlags = []cli.Flag{
 		cli.BoolFlag{Name: "expose-ports", Usage: "Enable ports from wercker.yml beeing exposed to the host system."},
@@ -203,6 +257,7 @@ var (
 		cli.Float64Flag{Name: "no-response-timeout", Value: 5, Usage: "Timeout if no script output is received in this many minutes."},
 		cli.Float64Flag{Name: "command-timeout", Value: 25, Usage: "Timeout if command does not complete in this many minutes."},
 		cli.StringFlag{Name: "wercker-yml", Value: "", Usage: "Specify a specific yaml file.", EnvVar: "WERCKER_YML_FILE"},
+		cli.StringFlag{Name: "failure-box", Value: "buildpack-deps:curl", Usage: "Box to run the after-steps in when the box of the pipeline can not be set up."},
 	}
 
 	// Steps options
@@ -237,6 +292,7 @@ var (
 		WerckerRegistryFlags,
 		DockerFlags,
 		InternalBuildFlags,
+		MatrixFlags,
 		GitFlags,
 		RegistryFlags,
 		ArtifactFlags,
@@ -274,6 +330,7 @@ var (
 	}
 
 	WorkflowFlagSet = [][]cli.Flag{
+		WorkflowFlags,
 		InternalBuildFlags,
 		LocalPathFlags,
 		DockerFlags,
@@ -281,6 +338,38 @@ var (
 		WerckerRegistryFlags,
 	}
 
+	WorkflowGraphFlagSet = [][]cli.Flag{
+		WorkflowGraphFlags,
+		InternalBuildFlags,
+		LocalPathFlags,
+		DockerFlags,
+		ConfigFlags,
+		WerckerRegistryFlags,
+	}
+
+	RunsListFlagSet = [][]cli.Flag{
+		RunsListFlags,
+		LocalPathFlags,
+	}
+
+	RunsShowFlagSet = [][]cli.Flag{
+		RunsShowFlags,
+		LocalPathFlags,
+	}
+
+	LogsFlagSet = [][]cli.Flag{
+		LogsFlags,
+		LocalPathFlags,
+	}
+
+	CheckConfigFlagSet = [][]cli.Flag{
+		CheckConfigFlags,
+	}
+
+	FormatFlagSet = [][]cli.Flag{
+		FormatFlags,
+	}
+
 	WerckerInternalFlagSet = [][]cli.Flag{
 		InternalPathFlags,
 		ReporterFlags,
@@ -0,0 +1,95 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+// cmdFormat rewrites the wercker.yml in its canonical form, printing a diff
+// or writing it in place. An ewok.yml is written as a wercker.yml.
+func cmdFormat(options *core.FormatOptions) error {
+	soft := NewSoftExit(options.GlobalOptions)
+	logger := util.RootLogger().WithField("Logger", "Main")
+
+	yamlFile := options.WerckerYml
+	if yamlFile == "" {
+		found, err := core.FindWerckerYaml([]string{"."})
+		if err != nil {
+			return soft.Exit(err)
+		}
+		yamlFile = found
+	}
+	werckerYaml, err := ioutil.ReadFile(yamlFile)
+	if err != nil {
+		return soft.Exit(err)
+	}
+
+	formatted, err := core.FormatConfig(yamlFile, werckerYaml)
+	if err != nil {
+		return soft.Exit(err)
+	}
+
+	target := yamlFile
+	if filepath.Base(yamlFile) == "ewok.yml" {
+		target = filepath.Join(filepath.Dir(yamlFile), "wercker.yml")
+	}
+
+	if !options.Write {
+		if target == yamlFile && string(formatted) == string(werckerYaml) {
+			return nil
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(werckerYaml)),
+			B:        difflib.SplitLines(string(formatted)),
+			FromFile: yamlFile,
+			ToFile:   target,
+			Context:  3,
+		})
+		if err != nil {
+			return soft.Exit(err)
+		}
+		fmt.Print(diff)
+		return nil
+	}
+
+	if target != yamlFile {
+		exists, err := util.Exists(target)
+		if err != nil {
+			return soft.Exit(err)
+		}
+		if exists {
+			return soft.Exit(fmt.Errorf("Cannot rename %s to %s, it already exists", yamlFile, target))
+		}
+	}
+	if err := ioutil.WriteFile(target, formatted, 0644); err != nil {
+		return soft.Exit(err)
+	}
+	if target != yamlFile {
+		if err := os.Remove(yamlFile); err != nil {
+			return soft.Exit(err)
+		}
+		logger.Println("Renamed", yamlFile, "to", target)
+	}
+	logger.Println("Wrote", target)
+	return nil
+}
@@ -0,0 +1,277 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/docker"
+)
+
+// workflowGraph is a workflow with the pipelines it runs resolved, it is
+// what workflow --plan and workflow graph show
+type workflowGraph struct {
+	Workflow  string               `json:"workflow"`
+	Pipelines []*workflowGraphNode `json:"pipelines"`
+	Edges     []*workflowGraphEdge `json:"edges"`
+}
+
+// workflowGraphNode is a pipeline of a workflow
+type workflowGraphNode struct {
+	Name string `json:"name"`
+	// Pipeline is the pipeline of the wercker.yml that is run
+	Pipeline string `json:"pipeline"`
+	// Stage is 1 for the pipelines that start the workflow, and one more
+	// than the last stage a pipeline requires otherwise
+	Stage      int      `json:"stage"`
+	Box        string   `json:"box"`
+	Services   []string `json:"services,omitempty"`
+	Steps      []string `json:"steps"`
+	AfterSteps []string `json:"afterSteps,omitempty"`
+	// Approval is set when the pipeline waits for approval before it runs
+	Approval bool `json:"approval,omitempty"`
+}
+
+// workflowGraphEdge is a pipeline that requires another one
+type workflowGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Artifacts is set when the output of From is the input of To, the
+	// same way nextPipeline picks the source runs of a pipeline
+	Artifacts bool `json:"artifacts"`
+}
+
+// pipelineDescriber fills in the box and steps of a node
+type pipelineDescriber func(node *workflowGraphNode) error
+
+// newWorkflowGraph builds the graph of workflow, which must be valid
+func newWorkflowGraph(workflow *core.WorkflowConfig, describe pipelineDescriber) (*workflowGraph, error) {
+	graph := &workflowGraph{Workflow: workflow.Name}
+	requires := map[string][]string{}
+	for _, pipeline := range workflow.Pipelines {
+		requires[pipeline.Name] = pipeline.Requires
+		node := &workflowGraphNode{
+			Name:     pipeline.Name,
+			Pipeline: pipeline.GetYAMLPipelineName(),
+			Approval: pipeline.Approval,
+		}
+		if err := describe(node); err != nil {
+			return nil, err
+		}
+		graph.Pipelines = append(graph.Pipelines, node)
+
+		for _, required := range pipeline.Requires {
+			graph.Edges = append(graph.Edges, &workflowGraphEdge{
+				From:      required,
+				To:        pipeline.Name,
+				Artifacts: pipeline.ArtifactPipeline == "" || pipeline.ArtifactPipeline == required,
+			})
+		}
+	}
+
+	stages := map[string]int{}
+	var stage func(name string, depth int) int
+	stage = func(name string, depth int) int {
+		if s, ok := stages[name]; ok {
+			return s
+		}
+		s := 1
+		// Validate rejects cycles, the depth only guards against them
+		if depth <= len(requires) {
+			for _, required := range requires[name] {
+				if r := stage(required, depth+1) + 1; r > s {
+					s = r
+				}
+			}
+		}
+		stages[name] = s
+		return s
+	}
+	for _, node := range graph.Pipelines {
+		node.Stage = stage(node.Name, 0)
+	}
+	return graph, nil
+}
+
+// dockerPipelineDescriber describes pipelines with the DockerPipeline they
+// resolve to, no containers are started
+func dockerPipelineDescriber(config *core.Config, options *core.PipelineOptions, dockerOptions *dockerlocal.Options) pipelineDescriber {
+	return func(node *workflowGraphNode) error {
+		opts := *options
+		opts.Pipeline = node.Pipeline
+		pipeline, err := dockerlocal.NewDockerPipeline(node.Pipeline, config, &opts, dockerOptions, dockerlocal.NewNilBuilder())
+		if err != nil {
+			return errors.Wrapf(err, "unable to resolve pipeline %s", node.Pipeline)
+		}
+		if box := pipeline.Box(); box != nil {
+			node.Box = box.GetName()
+		}
+		for _, service := range pipeline.Services() {
+			node.Services = append(node.Services, service.GetName())
+		}
+		node.Steps = []string{}
+		for _, step := range pipeline.Steps() {
+			node.Steps = append(node.Steps, step.DisplayName())
+		}
+		for _, step := range pipeline.AfterSteps() {
+			node.AfterSteps = append(node.AfterSteps, step.DisplayName())
+		}
+		return nil
+	}
+}
+
+// inputs returns the pipelines whose output is the input of name
+func (g *workflowGraph) inputs(name string) []string {
+	inputs := []string{}
+	for _, edge := range g.Edges {
+		if edge.To == name && edge.Artifacts {
+			inputs = append(inputs, edge.From)
+		}
+	}
+	return inputs
+}
+
+// requires returns the pipelines name waits for without using their output
+func (g *workflowGraph) requires(name string) []string {
+	requires := []string{}
+	for _, edge := range g.Edges {
+		if edge.To == name && !edge.Artifacts {
+			requires = append(requires, edge.From)
+		}
+	}
+	return requires
+}
+
+// Plan describes what running the workflow does, stage by stage
+func (g *workflowGraph) Plan() []string {
+	lines := []string{fmt.Sprintf("Workflow %s", g.Workflow)}
+	for stage := 1; ; stage++ {
+		nodes := []*workflowGraphNode{}
+		for _, node := range g.Pipelines {
+			if node.Stage == stage {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) == 0 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("Stage %d", stage))
+		for _, node := range nodes {
+			name := node.Name
+			if node.Pipeline != node.Name {
+				name = fmt.Sprintf("%s (pipeline %s)", node.Name, node.Pipeline)
+			}
+			lines = append(lines, "  "+name)
+
+			switch inputs := g.inputs(node.Name); len(inputs) {
+			case 0:
+				lines = append(lines, "    input: project directory")
+			case 1:
+				lines = append(lines, "    input: output of "+inputs[0])
+			default:
+				lines = append(lines, "    input: outputs of "+strings.Join(inputs, ", "))
+			}
+			if requires := g.requires(node.Name); len(requires) > 0 {
+				lines = append(lines, "    after: "+strings.Join(requires, ", "))
+			}
+			if node.Approval {
+				lines = append(lines, "    waits for approval")
+			}
+			lines = append(lines, "    box: "+node.Box)
+			if len(node.Services) > 0 {
+				lines = append(lines, "    services: "+strings.Join(node.Services, ", "))
+			}
+			lines = append(lines, "    steps: "+strings.Join(node.Steps, ", "))
+			if len(node.AfterSteps) > 0 {
+				lines = append(lines, "    after-steps: "+strings.Join(node.AfterSteps, ", "))
+			}
+		}
+	}
+	return lines
+}
+
+// Render returns the graph in format, which is dot, mermaid or json
+func (g *workflowGraph) Render(format string) (string, error) {
+	switch format {
+	case "dot":
+		return g.dot(), nil
+	case "mermaid":
+		return g.mermaid(), nil
+	case "json":
+		b, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	}
+	return "", errors.Errorf("unknown graph format %s, use dot, mermaid or json", format)
+}
+
+// label lists the box and number of steps of a node, one per line
+func (n *workflowGraphNode) label() []string {
+	label := []string{n.Name}
+	if n.Box != "" {
+		label = append(label, "box: "+n.Box)
+	}
+	label = append(label, fmt.Sprintf("%d steps", len(n.Steps)))
+	return label
+}
+
+func (g *workflowGraph) dot() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %q {\n", g.Workflow)
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, node := range g.Pipelines {
+		fmt.Fprintf(&b, "  %q [label=%q];\n", node.Name, strings.Join(node.label(), "\n"))
+	}
+	for _, edge := range g.Edges {
+		if edge.Artifacts {
+			fmt.Fprintf(&b, "  %q -> %q [label=\"artifacts\"];\n", edge.From, edge.To)
+		} else {
+			fmt.Fprintf(&b, "  %q -> %q [style=dashed];\n", edge.From, edge.To)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (g *workflowGraph) mermaid() string {
+	// Pipeline names may contain characters mermaid does not allow in ids
+	ids := map[string]string{}
+	for i, node := range g.Pipelines {
+		ids[node.Name] = fmt.Sprintf("p%d", i)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("graph LR\n")
+	for _, node := range g.Pipelines {
+		label := strings.Replace(strings.Join(node.label(), "<br/>"), `"`, "#quot;", -1)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[node.Name], label)
+	}
+	for _, edge := range g.Edges {
+		if edge.Artifacts {
+			fmt.Fprintf(&b, "  %s -->|artifacts| %s\n", ids[edge.From], ids[edge.To])
+		} else {
+			fmt.Fprintf(&b, "  %s -.-> %s\n", ids[edge.From], ids[edge.To])
+		}
+	}
+	return b.String()
+}
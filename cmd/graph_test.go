@@ -0,0 +1,113 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+type GraphSuite struct {
+	*util.TestSuite
+}
+
+func TestGraphSuite(t *testing.T) {
+	suiteTester := &GraphSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *GraphSuite) testGraph() *workflowGraph {
+	workflow := &core.WorkflowConfig{
+		Name: "release",
+		Pipelines: []core.WorkflowPipelineConfig{
+			{Name: "build"},
+			{Name: "test", Requires: []string{"build"}},
+			{Name: "lint", Requires: []string{"build"}},
+			{Name: "deploy", PipelineName: "push", Requires: []string{"test", "lint"}, ArtifactPipeline: "test", Approval: true},
+		},
+	}
+	describe := func(node *workflowGraphNode) error {
+		node.Box = "golang"
+		node.Steps = []string{"script"}
+		if node.Name == "build" {
+			node.Services = []string{"redis"}
+		}
+		return nil
+	}
+	graph, err := newWorkflowGraph(workflow, describe)
+	s.Require().Nil(err)
+	return graph
+}
+
+func (s *GraphSuite) TestWorkflowGraphPlan() {
+	s.Equal([]string{
+		"Workflow release",
+		"Stage 1",
+		"  build",
+		"    input: project directory",
+		"    box: golang",
+		"    services: redis",
+		"    steps: script",
+		"Stage 2",
+		"  test",
+		"    input: output of build",
+		"    box: golang",
+		"    steps: script",
+		"  lint",
+		"    input: output of build",
+		"    box: golang",
+		"    steps: script",
+		"Stage 3",
+		"  deploy (pipeline push)",
+		"    input: output of test",
+		"    after: lint",
+		"    waits for approval",
+		"    box: golang",
+		"    steps: script",
+	}, s.testGraph().Plan())
+}
+
+func (s *GraphSuite) TestWorkflowGraphRender() {
+	graph := s.testGraph()
+
+	dot, err := graph.Render("dot")
+	s.Require().Nil(err)
+	s.Contains(dot, `digraph "release" {`)
+	s.Contains(dot, `"build" [label="build\nbox: golang\n1 steps"];`)
+	s.Contains(dot, `"test" -> "deploy" [label="artifacts"];`)
+	s.Contains(dot, `"lint" -> "deploy" [style=dashed];`)
+
+	mermaid, err := graph.Render("mermaid")
+	s.Require().Nil(err)
+	s.Contains(mermaid, "graph LR\n")
+	s.Contains(mermaid, `p0["build<br/>box: golang<br/>1 steps"]`)
+	s.Contains(mermaid, "p0 -->|artifacts| p1")
+	s.Contains(mermaid, "p2 -.-> p3")
+
+	rendered, err := graph.Render("json")
+	s.Require().Nil(err)
+	var decoded workflowGraph
+	s.Require().Nil(json.Unmarshal([]byte(rendered), &decoded))
+	s.Len(decoded.Pipelines, 4)
+	s.Equal(3, decoded.Pipelines[3].Stage)
+	s.Len(decoded.Edges, 4)
+
+	_, err = graph.Render("svg")
+	s.NotNil(err)
+}
@@ -0,0 +1,181 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/event"
+)
+
+// logsFollowInterval is how often the logs of a run are checked for more
+// when following them
+var logsFollowInterval = 500 * time.Millisecond
+
+// cmdLogs replays the recorded logs of a run the way they were printed
+// while it ran
+func cmdLogs(opts *core.LogsOptions) error {
+	record, err := core.LoadRunRecord(opts.WorkingDir, opts.RunID)
+	if err != nil {
+		return err
+	}
+
+	// stdin is only printed when verbose, unless it was asked for
+	globalOpts := *opts.GlobalOptions
+	globalOpts.Verbose = globalOpts.Verbose || opts.Stream == "stdin"
+	handler, err := event.NewLiteralLogHandler(&core.PipelineOptions{GlobalOptions: &globalOpts})
+	if err != nil {
+		return err
+	}
+
+	replayer, err := newLogReplayer(opts, handler.Logs)
+	if err != nil {
+		return err
+	}
+	return replayLogs(opts.WorkingDir, record.RunID, opts.Follow, replayer)
+}
+
+// logReplayer passes the log records matching the options to emit, as the
+// Logs events they were recorded from
+type logReplayer struct {
+	opts *core.LogsOptions
+	grep *regexp.Regexp
+	emit func(*core.LogsArgs)
+	// pending has the start of the last line of a stream, while grepping
+	pending map[string]string
+}
+
+func newLogReplayer(opts *core.LogsOptions, emit func(*core.LogsArgs)) (*logReplayer, error) {
+	r := &logReplayer{opts: opts, emit: emit, pending: map[string]string{}}
+	if opts.Grep != "" {
+		grep, err := regexp.Compile(opts.Grep)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid --grep")
+		}
+		r.grep = grep
+	}
+	return r, nil
+}
+
+// Replay emits record when it matches the options, only its matching lines
+// when grepping
+func (r *logReplayer) Replay(record *core.LogRecord) {
+	if r.opts.Step != "" && record.Step != r.opts.Step && record.StepName != r.opts.Step {
+		return
+	}
+	if r.opts.Stream != "" && record.Stream != r.opts.Stream {
+		return
+	}
+	if r.grep == nil {
+		r.emit(&core.LogsArgs{Logs: record.Logs, Stream: record.Stream})
+		return
+	}
+
+	// Logs arrive in chunks that do not have to end with a line, keep the
+	// start of a line until the rest of it arrives
+	lines := strings.SplitAfter(r.pending[record.Stream]+record.Logs, "\n")
+	for _, line := range lines[:len(lines)-1] {
+		r.emitMatching(line, record.Stream)
+	}
+	r.pending[record.Stream] = lines[len(lines)-1]
+}
+
+// Flush emits the lines that did not end yet
+func (r *logReplayer) Flush() {
+	streams := []string{}
+	for stream := range r.pending {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	for _, stream := range streams {
+		if r.pending[stream] != "" {
+			r.emitMatching(r.pending[stream]+"\n", stream)
+		}
+	}
+	r.pending = map[string]string{}
+}
+
+func (r *logReplayer) emitMatching(line, stream string) {
+	if r.grep.MatchString(strings.TrimRight(line, "\r\n")) {
+		r.emit(&core.LogsArgs{Logs: line, Stream: stream})
+	}
+}
+
+// replayLogs reads the logs of run id and passes them to replayer. When
+// follow is set it keeps waiting for more logs until the run finishes, or
+// its process is gone because it was killed.
+func replayLogs(workingDir, id string, follow bool, replayer *logReplayer) error {
+	defer replayer.Flush()
+
+	// A run that is still being followed is done once it stopped running,
+	// reading what it logged before that
+	finished := func() bool {
+		record, err := core.LoadRunRecord(workingDir, id)
+		return err != nil || !record.Running()
+	}
+
+	path := core.RunsPath(workingDir, id, core.RunLogsFile)
+	file, err := os.Open(path)
+	for follow && os.IsNotExist(err) {
+		if finished() {
+			follow = false
+		} else {
+			time.Sleep(logsFollowInterval)
+		}
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to read the logs of the run")
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	line := ""
+	for {
+		chunk, err := reader.ReadString('\n')
+		line += chunk
+		if err == io.EOF {
+			if !follow {
+				// A last line without an end was still being written
+				return nil
+			}
+			if finished() {
+				follow = false
+			} else {
+				time.Sleep(logsFollowInterval)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		record := &core.LogRecord{}
+		if err := json.Unmarshal([]byte(line), record); err != nil {
+			return errors.Wrap(err, "unable to read the logs of the run")
+		}
+		replayer.Replay(record)
+		line = ""
+	}
+}
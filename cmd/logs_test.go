@@ -0,0 +1,165 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+type LogsSuite struct {
+	*util.TestSuite
+}
+
+func TestLogsSuite(t *testing.T) {
+	suiteTester := &LogsSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *LogsSuite) testLogs() []*core.LogRecord {
+	return []*core.LogRecord{
+		{Stream: "stdout", Logs: "Running step: setup\n"},
+		{Step: "go build", StepName: "script", Stream: "stdout", Logs: "building ./...\nok"},
+		{Step: "go build", StepName: "script", Stream: "stderr", Logs: "warning: unused\n"},
+		{Step: "go build", StepName: "script", Stream: "stdout", Logs: " done\n"},
+		{Step: "go test", StepName: "script", Stream: "stdout", Logs: "--- FAIL: TestRun\nFAIL\n"},
+		{Step: "go test", StepName: "script", Stream: "stderr", Logs: "exit status 1"},
+	}
+}
+
+func (s *LogsSuite) replay(opts *core.LogsOptions, records []*core.LogRecord) []string {
+	logs := []string{}
+	replayer, err := newLogReplayer(opts, func(args *core.LogsArgs) {
+		logs = append(logs, args.Stream+": "+args.Logs)
+	})
+	s.Require().Nil(err)
+	for _, record := range records {
+		replayer.Replay(record)
+	}
+	replayer.Flush()
+	return logs
+}
+
+func (s *LogsSuite) TestReplay() {
+	s.Equal([]string{
+		"stdout: Running step: setup\n",
+		"stdout: building ./...\nok",
+		"stderr: warning: unused\n",
+		"stdout:  done\n",
+		"stdout: --- FAIL: TestRun\nFAIL\n",
+		"stderr: exit status 1",
+	}, s.replay(&core.LogsOptions{}, s.testLogs()))
+
+	s.Equal([]string{
+		"stdout: building ./...\nok",
+		"stdout:  done\n",
+	}, s.replay(&core.LogsOptions{Step: "go build", Stream: "stdout"}, s.testLogs()))
+
+	s.Equal([]string{
+		"stderr: warning: unused\n",
+		"stderr: exit status 1",
+	}, s.replay(&core.LogsOptions{Step: "script", Stream: "stderr"}, s.testLogs()))
+}
+
+func (s *LogsSuite) TestReplayGrep() {
+	s.Equal([]string{
+		"stdout: ok done\n",
+		"stdout: FAIL\n",
+	}, s.replay(&core.LogsOptions{Grep: "^(ok|FAIL$)"}, s.testLogs()))
+
+	s.Equal([]string{
+		"stderr: exit status 1\n",
+	}, s.replay(&core.LogsOptions{Grep: "status", Step: "go test"}, s.testLogs()))
+
+	_, err := newLogReplayer(&core.LogsOptions{Grep: "FAIL("}, nil)
+	s.NotNil(err)
+}
+
+func (s *LogsSuite) TestReplayLogsFollow() {
+	defer func(interval time.Duration) { logsFollowInterval = interval }(logsFollowInterval)
+	logsFollowInterval = 10 * time.Millisecond
+
+	workingDir := s.WorkingDir()
+	record := &core.RunRecord{RunID: "run1", Pipeline: "build", Result: "running", Started: time.Now(), PID: os.Getpid()}
+	s.Require().Nil(record.Save(workingDir))
+
+	// The run logs the records one by one and finishes while they are followed
+	go func() {
+		file, err := os.Create(core.RunsPath(workingDir, "run1", core.RunLogsFile))
+		if err != nil {
+			return
+		}
+		defer file.Close()
+		encoder := json.NewEncoder(file)
+		for _, log := range s.testLogs() {
+			time.Sleep(5 * time.Millisecond)
+			encoder.Encode(log)
+		}
+		finished := time.Now()
+		record.Finished = &finished
+		record.Result = "failed"
+		record.Save(workingDir)
+	}()
+
+	logs := []string{}
+	replayer, err := newLogReplayer(&core.LogsOptions{}, func(args *core.LogsArgs) {
+		logs = append(logs, args.Logs)
+	})
+	s.Require().Nil(err)
+	s.Nil(replayLogs(workingDir, "run1", true, replayer))
+	s.Len(logs, len(s.testLogs()))
+}
+
+func (s *LogsSuite) TestReplayLogsFollowKilled() {
+	defer func(interval time.Duration) { logsFollowInterval = interval }(logsFollowInterval)
+	logsFollowInterval = 10 * time.Millisecond
+
+	// The run was killed, it never finishes and its process is gone
+	killed := exec.Command("true")
+	s.Require().Nil(killed.Run())
+	workingDir := s.WorkingDir()
+	record := &core.RunRecord{RunID: "run2", Pipeline: "build", Result: "running", Started: time.Now(), PID: killed.Process.Pid}
+	s.Require().Nil(record.Save(workingDir))
+
+	file, err := os.Create(core.RunsPath(workingDir, "run2", core.RunLogsFile))
+	s.Require().Nil(err)
+	encoder := json.NewEncoder(file)
+	for _, log := range s.testLogs() {
+		s.Require().Nil(encoder.Encode(log))
+	}
+	s.Require().Nil(file.Close())
+
+	logs := []string{}
+	replayer, err := newLogReplayer(&core.LogsOptions{}, func(args *core.LogsArgs) {
+		logs = append(logs, args.Logs)
+	})
+	s.Require().Nil(err)
+	done := make(chan error)
+	go func() { done <- replayLogs(workingDir, "run2", true, replayer) }()
+	select {
+	case err := <-done:
+		s.Nil(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("following the logs of a killed run did not stop")
+	}
+	s.Len(logs, len(s.testLogs()))
+}
@@ -22,7 +22,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -128,7 +127,7 @@ var (
 				os.Exit(1)
 			}
 		},
-		Flags: FlagsFor(PipelineFlagSet, WerckerInternalFlagSet),
+		Flags: FlagsFor(PipelineFlagSet, CheckConfigFlagSet, WerckerInternalFlagSet),
 	}
 
 	deployCommand = cli.Command{
@@ -180,6 +179,88 @@ var (
 		},
 	}
 
+	logsCommand = cli.Command{
+		Name:      "logs",
+		Usage:     "show the logs of a local run recorded in the working dir",
+		ArgsUsage: "<run id>",
+		Action: func(c *cli.Context) {
+			settings := util.NewCLISettings(c)
+			env := util.NewEnvironment(os.Environ()...)
+			opts, err := core.NewLogsOptions(settings, env)
+			if err != nil {
+				cliLogger.Errorln("Invalid options\n", err)
+				os.Exit(1)
+			}
+			opts.RunID = c.Args().Get(0)
+			if opts.RunID == "" {
+				cliLogger.Errorln("Missing run id to show the logs of")
+				os.Exit(1)
+			}
+			err = cmdLogs(opts)
+			if err != nil {
+				cliLogger.Fatalf("Unable to show logs: %s", err)
+			}
+		},
+		Flags: FlagsFor(LogsFlagSet),
+	}
+
+	runsCommand = cli.Command{
+		Name:  "runs",
+		Usage: "look at the local runs recorded in the working dir",
+		Subcommands: []cli.Command{
+			{
+				Name:  "list",
+				Usage: "list the recorded runs, the latest first",
+				Action: func(c *cli.Context) {
+					opts := runsOptions(c)
+					err := cmdRunsList(opts)
+					if err != nil {
+						cliLogger.Fatalf("Unable to list runs: %s", err)
+					}
+				},
+				Flags: FlagsFor(RunsListFlagSet),
+			},
+			{
+				Name:      "show",
+				Usage:     "show the steps, results and configuration of a recorded run",
+				ArgsUsage: "<run id>",
+				Action: func(c *cli.Context) {
+					opts := runsOptions(c)
+					opts.RunID = c.Args().Get(0)
+					if opts.RunID == "" {
+						cliLogger.Errorln("Missing run id to show")
+						os.Exit(1)
+					}
+					err := cmdRunsShow(opts)
+					if err != nil {
+						cliLogger.Fatalf("Unable to show run: %s", err)
+					}
+				},
+				Flags: FlagsFor(RunsShowFlagSet),
+			},
+		},
+	}
+
+	formatCommand = cli.Command{
+		Name:    "fmt",
+		Aliases: []string{"migrate-yml"},
+		Usage:   "rewrite the project's yaml in its canonical form",
+		Action: func(c *cli.Context) {
+			settings := util.NewCLISettings(c)
+			env := util.NewEnvironment(os.Environ()...)
+			opts, err := core.NewFormatOptions(settings, env)
+			if err != nil {
+				cliLogger.Errorln("Invalid options\n", err)
+				os.Exit(1)
+			}
+			err = cmdFormat(opts)
+			if err != nil {
+				os.Exit(1)
+			}
+		},
+		Flags: FlagsFor(FormatFlagSet),
+	}
+
 	inspectCommand = cli.Command{
 		Name:      "inspect",
 		ShortName: "i",
@@ -443,39 +524,29 @@ var (
 		Usage:     "run workflows locally (experimental)",
 		Action: func(c *cli.Context) {
 			ctx := context.Background()
-			envfile := c.GlobalString("environment")
-			env := util.NewEnvironment(os.Environ()...)
-			env.LoadFile(envfile)
-			env.PassThruProxyConfig()
+			opts, dockerOptions := workflowOptions(ctx, c)
 
-			// We do not want `target` to be set by NewCLISettings()
-			// because it will conflict with the workflow name.
-			settings := util.NewCLISettings(c)
-			settings.CheapSettings = util.NewCheapSettings(map[string]interface{}{})
-
-			opts, err := core.NewWorkflowOptions(settings, env)
-			if err != nil {
-				cliLogger.Errorln("Invalid options\n", err)
-				os.Exit(1)
-			}
-
-			opts.WorkflowName = c.Args().Get(0)
-			if opts.WorkflowName == "" {
-				cliLogger.Errorln("Missing workflow name to run")
-				os.Exit(1)
-			}
-
-			dockerOptions, err := dockerlocal.NewOptions(ctx, settings, env)
-			if err != nil {
-				cliLogger.Errorln("Invalid Docker options\n", err)
-				os.Exit(1)
-			}
-
-			err = cmdWorkflow(ctx, opts, dockerOptions)
+			err := cmdWorkflow(ctx, opts, dockerOptions)
 			if err != nil {
 				cliLogger.Fatalf("Unable to run workflow: %s", err)
 			}
 		},
+		Subcommands: []cli.Command{
+			{
+				Name:  "graph",
+				Usage: "print the pipelines of a workflow and how they depend on each other",
+				Action: func(c *cli.Context) {
+					ctx := context.Background()
+					opts, dockerOptions := workflowOptions(ctx, c)
+
+					err := cmdWorkflowGraph(opts, dockerOptions)
+					if err != nil {
+						cliLogger.Fatalf("Unable to graph workflow: %s", err)
+					}
+				},
+				Flags: FlagsFor(WorkflowGraphFlagSet, WerckerInternalFlagSet),
+			},
+		},
 		Flags: FlagsFor(WorkflowFlagSet, WerckerInternalFlagSet),
 	}
 )
@@ -535,10 +606,13 @@ func GetApp() *cli.App {
 		checkConfigCommand,
 		deployCommand,
 		detectCommand,
+		formatCommand,
 		// inspectCommand,
 		loginCommand,
 		logoutCommand,
+		logsCommand,
 		pullCommand,
+		runsCommand,
 		versionCommand,
 		documentCommand(app),
 		dockerCommand,
@@ -595,6 +669,14 @@ func cmdBuild(ctx context.Context, options *core.PipelineOptions, dockerOptions
 	if options.Pipeline == "" {
 		options.Pipeline = "build"
 	}
+	// Pipelines with a matrix run each of their expansions instead, when the
+	// config can't be read here executePipeline will report the problem
+	if config, err := readPipelineConfig(options); err == nil {
+		pipeline := config.PipelinesMap[options.Pipeline]
+		if pipeline != nil && pipeline.PipelineConfig != nil && len(pipeline.MatrixPipelines) > 0 {
+			return nil, cmdBuildMatrix(ctx, options, dockerOptions, config)
+		}
+	}
 	pipelineGetter := GetBuildPipelineFactory(options.Pipeline)
 	ctx = core.NewEmitterContext(ctx)
 	return executePipeline(ctx, options, dockerOptions, pipelineGetter)
@@ -609,39 +691,112 @@ func cmdDeploy(ctx context.Context, options *core.PipelineOptions, dockerOptions
 	return executePipeline(ctx, options, dockerOptions, pipelineGetter)
 }
 
-func cmdCheckConfig(options *core.PipelineOptions, dockerOptions *dockerlocal.Options) error {
+// runsOptions reads the options of the runs commands
+func runsOptions(c *cli.Context) *core.RunsOptions {
+	settings := util.NewCLISettings(c)
+	env := util.NewEnvironment(os.Environ()...)
+	opts, err := core.NewRunsOptions(settings, env)
+	if err != nil {
+		cliLogger.Errorln("Invalid options\n", err)
+		os.Exit(1)
+	}
+	return opts
+}
+
+// workflowOptions reads the options of the workflow commands, the workflow
+// name is their first argument
+func workflowOptions(ctx context.Context, c *cli.Context) (*core.WorkflowOptions, *dockerlocal.Options) {
+	envfile := c.GlobalString("environment")
+	env := util.NewEnvironment(os.Environ()...)
+	env.LoadFile(envfile)
+	env.PassThruProxyConfig()
+
+	// We do not want `target` to be set by NewCLISettings()
+	// because it will conflict with the workflow name.
+	settings := util.NewCLISettings(c)
+	settings.CheapSettings = util.NewCheapSettings(map[string]interface{}{})
+
+	opts, err := core.NewWorkflowOptions(settings, env)
+	if err != nil {
+		cliLogger.Errorln("Invalid options\n", err)
+		os.Exit(1)
+	}
+
+	opts.WorkflowName = c.Args().Get(0)
+	if opts.WorkflowName == "" {
+		cliLogger.Errorln("Missing workflow name to run")
+		os.Exit(1)
+	}
+
+	dockerOptions, err := dockerlocal.NewOptions(ctx, settings, env)
+	if err != nil {
+		cliLogger.Errorln("Invalid Docker options\n", err)
+		os.Exit(1)
+	}
+	return opts, dockerOptions
+}
+
+func cmdCheckConfig(options *core.CheckConfigOptions, dockerOptions *dockerlocal.Options) error {
 	soft := NewSoftExit(options.GlobalOptions)
 	logger := util.RootLogger().WithField("Logger", "Main")
 
+	if options.PrintSchema {
+		fmt.Print(core.ConfigSchema)
+		return nil
+	}
+
 	// TODO(termie): this is pretty much copy-paste from the
 	//               runner.GetConfig step, we should probably refactor
-	var werckerYaml []byte
-	var err error
-	if options.WerckerYml != "" {
-		werckerYaml, err = ioutil.ReadFile(options.WerckerYml)
+	yamlFile := options.WerckerYml
+	if yamlFile == "" {
+		found, err := core.FindWerckerYaml([]string{"."})
 		if err != nil {
 			return soft.Exit(err)
 		}
-	} else {
-		werckerYaml, err = core.ReadWerckerYaml([]string{"."}, false)
-		if err != nil {
-			return soft.Exit(err)
+		yamlFile = found
+	}
+	werckerYaml, err := ioutil.ReadFile(yamlFile)
+	if err != nil {
+		return soft.Exit(err)
+	}
+
+	if options.Strict {
+		errorCount := 0
+		for _, problem := range core.LintConfig(yamlFile, werckerYaml) {
+			if problem.IsError() {
+				errorCount++
+				logger.Errorln(problem)
+			} else {
+				logger.Warnln(problem)
+			}
+		}
+		if errorCount > 0 {
+			return soft.Exit(fmt.Errorf("%s has %d error(s)", yamlFile, errorCount))
 		}
 	}
 
 	// Parse that bad boy.
-	rawConfig, err := core.ConfigFromYaml(werckerYaml)
+	rawConfig, err := core.ConfigFromYamlFile(yamlFile, werckerYaml)
 	if err != nil {
 		return soft.Exit(err)
 	}
 
 	for name := range rawConfig.PipelinesMap {
 		options.Pipeline = name
-		build, err := dockerlocal.NewDockerPipeline(name, rawConfig, options, dockerOptions, dockerlocal.NewNilBuilder())
+		build, err := dockerlocal.NewDockerPipeline(name, rawConfig, options.PipelineOptions, dockerOptions, dockerlocal.NewNilBuilder())
 		if err != nil {
 			return soft.Exit(err)
 		}
 		logger.Println("Found pipeline section:", name)
+		logger.Println("  from:", rawConfig.PipelineSources[name])
+		if pipeline := rawConfig.PipelinesMap[name]; pipeline != nil {
+			if pipeline.Extends != "" {
+				logger.Println("  extends:", pipeline.Extends)
+			}
+			if pipeline.MatrixExpansion != nil {
+				logger.Println("  matrix expansion of", pipeline.MatrixParent+":", pipeline.MatrixExpansion.Label())
+			}
+		}
 		if build.Box() != nil {
 			logger.Println("  with box:", build.Box().GetName())
 		}
@@ -654,6 +809,15 @@ func cmdCheckConfig(options *core.PipelineOptions, dockerOptions *dockerlocal.Op
 			exitErr := fmt.Errorf("invalid workflow %s: %s", workflow.Name, err.Error())
 			return soft.Exit(exitErr)
 		}
+		if options.Verbose {
+			graph, err := newWorkflowGraph(workflow, dockerPipelineDescriber(rawConfig, options.PipelineOptions, dockerOptions))
+			if err != nil {
+				return soft.Exit(err)
+			}
+			for _, line := range graph.Plan()[1:] {
+				logger.Println("  " + line)
+			}
+		}
 	}
 
 	return nil
@@ -667,56 +831,38 @@ func cmdDetect(options *core.DetectOptions) error {
 
 	logger.Println("########### Detecting your project! #############")
 
-	detected := ""
-
-	d, err := os.Open(".")
+	projects, err := core.DetectProjects(".")
 	if err != nil {
-		logger.WithField("Error", err).Error("Unable to open directory")
-		soft.Exit(err)
+		logger.WithField("Error", err).Error("Unable to read directory")
+		return soft.Exit(err)
+	}
+	if len(projects) == 0 {
+		logger.Println("No stack detected, generating default wercker.yml")
+	}
+	for _, project := range projects {
+		services := []string{}
+		for _, service := range project.Services {
+			services = append(services, service.ID)
+		}
+		logger.Println("Detected:", project.Stack, "in", project.Dir, "using", project.Box())
+		if len(services) > 0 {
+			logger.Println("  with services:", strings.Join(services, ", "))
+		}
 	}
-	defer d.Close()
 
-	files, err := d.Readdir(-1)
-	if err != nil {
-		logger.WithField("Error", err).Error("Unable to read directory")
-		soft.Exit(err)
-	}
-outer:
-	for _, f := range files {
-		switch {
-		case f.Name() == "package.json":
-			detected = "nodejs"
-			break outer
-
-		case f.Name() == "requirements.txt":
-			detected = "python"
-			break outer
-
-		case f.Name() == "Gemfile":
-			detected = "ruby"
-			break outer
-
-		case filepath.Ext(f.Name()) == ".go":
-			detected = "golang"
-			break outer
-
-		case f.Name() == "pom.xml":
-			detected = "java-maven"
-			break outer
-
-		case filepath.Ext(f.Name()) == ".gradle", f.Name() == "gradlew":
-			detected = "java-gradle"
-			break outer
+	yml := "wercker.yml"
+	if _, err := os.Stat(yml); err == nil {
+		logger.Println(yml, "already exists. Do you want to overwrite? (yes/no)")
+		if !askForConfirmation() {
+			logger.Println("Exiting...")
+			return soft.Exit(fmt.Errorf("%s already exists", yml))
 		}
 	}
-	if detected == "" {
-		logger.Println("No stack detected, generating default wercker.yml")
-		detected = "default"
-	} else {
-		logger.Println("Detected:", detected)
-		logger.Println("Generating wercker.yml")
+	logger.Println("Generating", yml)
+	if err := ioutil.WriteFile(yml, core.GenerateConfigYaml(projects), 0644); err != nil {
+		logger.WithField("Error", err).Error("Unable to write wercker.yml file")
+		return soft.Exit(err)
 	}
-	getYml(detected, options)
 	return nil
 }
 
@@ -1006,37 +1152,6 @@ func cmdVersion(options *core.VersionOptions) error {
 }
 
 // TODO(mies): maybe move to util.go at some point
-func getYml(detected string, options *core.DetectOptions) {
-	logger := util.RootLogger().WithField("Logger", "Main")
-
-	yml := "wercker.yml"
-	if _, err := os.Stat(yml); err == nil {
-		logger.Println(yml, "already exists. Do you want to overwrite? (yes/no)")
-		if !askForConfirmation() {
-			logger.Println("Exiting...")
-			os.Exit(1)
-		}
-	}
-	url := fmt.Sprintf("%s/api/v2/yml/%s", options.BaseURL, detected)
-	res, err := http.Get(url)
-	if err != nil {
-		logger.WithField("Error", err).Error("Unable to reach wercker API")
-		os.Exit(1)
-	}
-	defer res.Body.Close()
-
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		logger.WithField("Error", err).Error("Unable to read response")
-	}
-
-	err = ioutil.WriteFile("wercker.yml", body, 0644)
-	if err != nil {
-		logger.WithField("Error", err).Error("Unable to write wercker.yml file")
-	}
-
-}
-
 // DumpOptions prints out a sorted list of options
 func DumpOptions(options interface{}, indent ...string) {
 	indent = append(indent, "  ")
@@ -1075,6 +1190,9 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 		"Logger": "Main",
 		"RunID":  options.RunID,
 	})
+	if options.LogPrefix != "" {
+		logger = logger.WithField("Prefix", options.LogPrefix)
+	}
 	e, err := core.EmitterFromContext(cmdCtx)
 	if err != nil {
 		return nil, err
@@ -1090,6 +1208,7 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 	// Main timer
 	mainTimer := util.NewTimer()
 	timer := util.NewTimer()
+	started := time.Now()
 
 	// These will be emitted at the end of the execution, we're going to be
 	// pessimistic and report that we failed, unless overridden at the end of the
@@ -1147,6 +1266,35 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 			Stream: "stderr",
 			Logs:   err.Error() + "\n",
 		})
+
+		// The steps never ran, but on-failure and always still should so
+		// failures such as a box that can not be pulled get reported
+		if shared != nil && shared.pipeline != nil && len(shared.pipeline.AfterStepsFor(false)) > 0 {
+			pipelineArgs.RanAfterSteps = true
+			logger.Println(f.Info("Starting after-steps"))
+			failureShared, failureErr := r.SetupFailureEnvironment(cmdCtx, shared)
+			if failureShared != nil && failureShared.box != shared.box {
+				if options.ShouldRemove {
+					defer failureShared.box.Clean()
+				}
+				defer failureShared.box.Stop()
+			}
+			if failureErr != nil {
+				logger.WithField("Error", failureErr).Errorln("Unable to run after-steps")
+			} else {
+				pr := &core.PipelineResult{
+					Success:           false,
+					FailedStepName:    "setup environment",
+					FailedStepMessage: err.Error(),
+				}
+				// Skip the counter past the steps and store, like a
+				// pipeline whose steps failed
+				stepCounter := &util.Counter{Current: len(shared.pipeline.Steps()) + 4}
+				if afterErr := r.RunAfterSteps(cmdCtx, failureShared, pr, stepCounter); afterErr != nil {
+					logger.WithField("Error", afterErr).Errorln("Unable to run after-steps")
+				}
+			}
+		}
 		return nil, soft.Exit(err)
 	}
 	if options.Verbose {
@@ -1207,12 +1355,36 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 		FailedStepMessage: "",
 	}
 
+	// A pipeline timeout cancels the session the steps run in once the
+	// deadline passes, the after-steps get a new session so they still run
+	stepsShared := shared
+	timeoutMessage := ""
+	if options.PipelineTimeout > 0 {
+		deadline := started.Add(time.Duration(options.PipelineTimeout) * time.Millisecond)
+		stepsCtx, cancel := context.WithDeadline(shared.sessionCtx, deadline)
+		defer cancel()
+		stepsShared = &RunnerShared{}
+		*stepsShared = *shared
+		stepsShared.sessionCtx = stepsCtx
+		timeoutMessage = fmt.Sprintf("Pipeline timed out after %d minutes", options.PipelineTimeout/60/1000)
+	}
+	pipelineTimedOut := func() bool {
+		return stepsShared.sessionCtx.Err() == context.DeadlineExceeded
+	}
+
 	// stepCounter starts at 3, step 1 is "get code", step 2 is "setup
 	// environment".
 	stepCounter := &util.Counter{Current: 3}
 	checkpoint := false
 	for _, step := range pipeline.Steps() {
 		defer step.Clean()
+		if pipelineTimedOut() {
+			pr.Success = false
+			pr.FailedStepName = step.DisplayName()
+			pr.FailedStepMessage = timeoutMessage
+			logger.Printf(f.Fail(timeoutMessage))
+			break
+		}
 		// we always want to run the wercker-init step to provide some functions
 		if !checkpoint && stepCounter.Current > 3 {
 			if options.EnableDevSteps && options.Checkpoint != "" {
@@ -1228,8 +1400,17 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 		}
 		logger.Printf(f.Info("Running step", step.DisplayName()))
 		timer.Reset()
-		sr, err := r.RunStep(cmdCtx, shared, step, stepCounter.Increment())
+		sr, err := r.RunStep(cmdCtx, stepsShared, step, stepCounter.Increment())
 		if err != nil {
+			if pipelineTimedOut() {
+				sr.Message = timeoutMessage
+			} else if step.AllowFailure() {
+				// The step still reports as failed, but the pipeline carries on
+				pr.AddWarning(step.DisplayName(), sr.Message)
+				logger.Printf(f.Fail("Step failed", step.DisplayName(), sr.Message, timer.String()))
+				logger.Warnln(f.Info("Continuing, step is allowed to fail", step.DisplayName()))
+				continue
+			}
 			pr.Success = false
 			pr.FailedStepName = step.DisplayName()
 			pr.FailedStepMessage = sr.Message
@@ -1238,6 +1419,11 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 			break
 		}
 
+		if sr.Skipped {
+			logger.Printf(f.Info("Skipped step", step.DisplayName(), sr.Message))
+			continue
+		}
+
 		if options.EnableDevSteps && step.Checkpoint() != "" {
 			logger.Printf(f.Info("Checkpointing", step.Checkpoint()))
 			box.Commit(box.Repository(), fmt.Sprintf("w-%s", step.Checkpoint()), "checkpoint", false)
@@ -1387,16 +1573,29 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 		stepCounter.Increment()
 	}
 
+	// Keep the outputs of the steps for the pipelines of a workflow that
+	// require this one
+	if pr.Success && options.ShouldArtifacts {
+		err = pipeline.CollectOutputs(cmdCtx, shared.containerID)
+		if err != nil {
+			pr.Success = false
+			logger.WithField("Error", err).Error("Unable to store pipeline outputs")
+		}
+	}
+
 	// We're sending our build finished but we're not done yet,
 	// now is time to run after-steps if we have any
 	if pr.Success {
 		logger.Println(f.Success("Steps passed", mainTimer.String()))
 		buildFinishedArgs.Result = "passed"
 	}
+	for _, warning := range pr.Warnings {
+		logger.Warnln(f.Info("Warning", warning))
+	}
 	buildFinisher.Finish(buildFinishedArgs)
 	pipelineArgs.MainSuccessful = pr.Success
 
-	if len(pipeline.AfterSteps()) == 0 {
+	if len(pipeline.AfterStepsFor(pr.Success)) == 0 {
 		// We're about to end the build, so pull the cache and explode it
 		// into the CacheDir
 		if !options.DirectMount {
@@ -1451,23 +1650,11 @@ func executePipeline(cmdCtx context.Context, options *core.PipelineOptions, dock
 		return nil, err
 	}
 
-	// Add the After-Step parts
-	err = pr.ExportEnvironment(newSessCtx, newSess)
+	err = r.RunAfterSteps(cmdCtx, newShared, pr, stepCounter)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, step := range pipeline.AfterSteps() {
-		logger.Println(f.Info("Running after-step", step.DisplayName()))
-		timer.Reset()
-		_, err := r.RunStep(cmdCtx, newShared, step, stepCounter.Increment())
-		if err != nil {
-			logger.Println(f.Fail("After-step failed", step.DisplayName(), timer.String()))
-			break
-		}
-		logger.Println(f.Success("After-step passed", step.DisplayName(), timer.String()))
-	}
-
 	// We're about to end the build, so pull the cache and explode it
 	// into the CacheDir
 	if !options.DirectMount {
@@ -0,0 +1,138 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/docker"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// matrixResult is the outcome of a single matrix expansion
+type matrixResult struct {
+	pipeline string
+	label    string
+	runID    string
+	duration string
+	err      error
+}
+
+// readPipelineConfig reads the wercker.yml of the project in options without
+// requiring the code to be copied first.
+func readPipelineConfig(options *core.PipelineOptions) (*core.Config, error) {
+	var werckerYaml []byte
+	var err error
+	yamlFile := options.WerckerYml
+	if yamlFile != "" {
+		werckerYaml, err = ioutil.ReadFile(yamlFile)
+	} else {
+		yamlFile, werckerYaml, err = core.ReadWerckerYaml([]string{options.ProjectPath}, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return core.ConfigFromYamlFile(yamlFile, werckerYaml)
+}
+
+// cmdBuildMatrix runs every expansion of the matrix of a pipeline, either
+// sequentially or in parallel, and prints a summary of the results. Every
+// expansion gets its own RunID and its own project directory, and its own
+// cache directory when they run in parallel.
+func cmdBuildMatrix(ctx context.Context, options *core.PipelineOptions, dockerOptions *dockerlocal.Options, config *core.Config) error {
+	logger := util.RootLogger().WithField("Logger", "Main")
+	f := &util.Formatter{ShowColors: options.GlobalOptions.ShowColors}
+
+	pipeline := config.PipelinesMap[options.Pipeline]
+	results := make([]*matrixResult, len(pipeline.MatrixPipelines))
+
+	run := func(i int, name string) {
+		expansion := config.PipelinesMap[name].MatrixExpansion
+
+		opts := *options
+		opts.Pipeline = name
+		opts.RunID = bson.NewObjectId().Hex()
+		opts.Namespace = name
+		// Tell the output of the expansions apart when they run side by side,
+		// and keep them from writing to the same cache
+		if options.MatrixParallel {
+			opts.LogPrefix = name
+			opts.SeparateCache = true
+		}
+		dockerOpts := *dockerOptions
+
+		logger.Println(f.Info("Starting matrix pipeline", name, expansion.Label()))
+		timer := util.NewTimer()
+		pipelineCtx := core.NewEmitterContext(ctx)
+		_, err := executePipeline(pipelineCtx, &opts, &dockerOpts, GetBuildPipelineFactory(name))
+		results[i] = &matrixResult{
+			pipeline: name,
+			label:    expansion.Label(),
+			runID:    opts.RunID,
+			duration: timer.String(),
+			err:      err,
+		}
+	}
+
+	if options.MatrixParallel {
+		var wg sync.WaitGroup
+		for i, name := range pipeline.MatrixPipelines {
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				run(i, name)
+			}(i, name)
+		}
+		wg.Wait()
+	} else {
+		for i, name := range pipeline.MatrixPipelines {
+			run(i, name)
+		}
+	}
+
+	failed := 0
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PIPELINE\tMATRIX\tRESULT\tDURATION\tRUN ID")
+	for _, result := range results {
+		status := "passed"
+		if result.err != nil {
+			status = "failed"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.pipeline, result.label, status, result.duration, result.runID)
+	}
+	w.Flush()
+
+	logger.Println(f.Info("Matrix results", options.Pipeline))
+	for _, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+		logger.Println(line)
+	}
+
+	if failed > 0 {
+		logger.Println(f.Fail("Matrix failed", fmt.Sprintf("%d of %d pipelines failed", failed, len(results))))
+		return fmt.Errorf("%d of %d matrix pipelines failed", failed, len(results))
+	}
+	logger.Println(f.Success("Matrix passed", fmt.Sprintf("%d pipelines", len(results))))
+	return nil
+}
@@ -21,6 +21,8 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/monochromegane/go-gitignore"
@@ -89,6 +91,11 @@ type Runner struct {
 	emitter       *core.NormalizedEmitter
 	formatter     *util.Formatter
 	rdd           *rdd.RDD
+	// codeCopied is set once EnsureCode put the code in the ProjectDir, the
+	// default wercker.yml is only generated from the copied code
+	codeCopied      bool
+	defaultYamlFile string
+	defaultYaml     []byte
 }
 
 // NewRunner from global options
@@ -98,6 +105,9 @@ func NewRunner(ctx context.Context, options *core.PipelineOptions, dockerOptions
 		return nil, errors.Wrap(err, "could not create emmiter from context")
 	}
 	logger := util.RootLogger().WithField("Logger", "Runner")
+	if options.LogPrefix != "" {
+		logger = logger.WithField("Prefix", options.LogPrefix)
+	}
 	// h, err := NewLogHandler()
 	// if err != nil {
 	//   p.logger.WithField("Error", err).Panic("Unable to LogHandler")
@@ -115,6 +125,12 @@ func NewRunner(ctx context.Context, options *core.PipelineOptions, dockerOptions
 	}
 	l.ListenTo(e)
 
+	h, err := event.NewRunHistoryHandler(options)
+	if err != nil {
+		logger.WithField("Error", err).Panic("Unable to event.RunHistoryHandler")
+	}
+	h.ListenTo(e)
+
 	var r *event.ReportHandler
 	if options.ShouldReport {
 		r, err := event.NewReportHandler(options.ReporterHost, options.ReporterKey)
@@ -141,6 +157,9 @@ func (p *Runner) ProjectDir() string {
 	if p.options.DirectMount {
 		return p.options.ProjectPath
 	}
+	if p.options.Namespace != "" {
+		return fmt.Sprintf("%s/%s-%s", p.options.ProjectDownloadPath(), p.options.ApplicationID, p.options.Namespace)
+	}
 	return fmt.Sprintf("%s/%s", p.options.ProjectDownloadPath(), p.options.ApplicationID)
 }
 
@@ -153,6 +172,7 @@ func (p *Runner) ProjectDir() string {
 func (p *Runner) EnsureCode() (string, error) {
 	projectDir := p.ProjectDir()
 	if p.options.DirectMount {
+		p.codeCopied = true
 		return projectDir, nil
 	}
 
@@ -172,55 +192,14 @@ func (p *Runner) EnsureCode() (string, error) {
 	} else {
 
 		// We were pointed at a path with ProjectPath, copy it to projectDir
-
-		ignoreFiles := []string{
-			p.options.WorkingDir,
-		}
-
-		oldbuilds, _ := filepath.Abs("./_builds")
-		oldprojects, _ := filepath.Abs("./_projects")
-		oldsteps, _ := filepath.Abs("./_steps")
-		oldcache, _ := filepath.Abs("./_cache")
-		oldcontainers, _ := filepath.Abs("./_containers")
-		deprecatedPaths := []string{
-			oldbuilds,
-			oldprojects,
-			oldsteps,
-			oldcache,
-			oldcontainers,
-		}
-
 		var err error
 
-		var ignoreFile, _ = gitignore.NewGitIgnore(p.options.IgnoreFilePath())
-
-		// Make sure we don't accidentally recurse or copy extra files
-		ignoreFunc := func(src string, files []os.FileInfo) []string {
-			ignores := []string{}
-			for _, file := range files {
-				abspath, err := filepath.Abs(filepath.Join(src, file.Name()))
-				if err != nil {
-					// Something went sufficiently wrong
-					panic(errors.Wrapf(err, "could not create absolute path for %s/%s", src, file.Name()))
-				}
-				if util.ContainsString(ignoreFiles, abspath) || (ignoreFile != nil && ignoreFile.Match(abspath, file.IsDir())) {
-					ignores = append(ignores, file.Name())
-				}
-
-				// TODO(termie): remove this warning after a while
-				if util.ContainsString(deprecatedPaths, abspath) {
-					p.logger.Warnln(fmt.Sprintf("Not ignoring deprecated runtime path, %s. You probably want to delete it so it doesn't get copied into your container. Runtime files are now stored under '.wercker' by default. This message will go away in a future update.", file.Name()))
-				}
-			}
-			return ignores
-		}
-
 		// This is a hack to get rid of complaint that builds folder does not exist.
 		if p.options.LocalFileStore != "" || p.options.ShouldStoreOCI {
 			os.MkdirAll(fmt.Sprintf("%s/builds", p.options.WorkingDir), 0700)
 		}
 
-		copyOpts := &shutil.CopyTreeOptions{Ignore: ignoreFunc, CopyFunction: shutil.Copy, Symlinks: true}
+		copyOpts := &shutil.CopyTreeOptions{Ignore: projectCopyIgnore(p.options, p.logger), CopyFunction: shutil.Copy, Symlinks: true}
 		os.Rename(projectDir, fmt.Sprintf("%s-%s", projectDir, uuid.NewRandom().String()))
 
 		if len(p.options.ProjectPathsByPipeline) == 0 {
@@ -243,9 +222,54 @@ func (p *Runner) EnsureCode() (string, error) {
 		}
 
 	}
+	p.codeCopied = true
 	return projectDir, nil
 }
 
+// projectCopyIgnore returns the function that tells which files are left out
+// when the project is copied: the working dir and what the ignore file lists
+func projectCopyIgnore(options *core.PipelineOptions, logger *util.LogEntry) func(string, []os.FileInfo) []string {
+	ignoreFiles := []string{
+		options.WorkingDir,
+	}
+
+	oldbuilds, _ := filepath.Abs("./_builds")
+	oldprojects, _ := filepath.Abs("./_projects")
+	oldsteps, _ := filepath.Abs("./_steps")
+	oldcache, _ := filepath.Abs("./_cache")
+	oldcontainers, _ := filepath.Abs("./_containers")
+	deprecatedPaths := []string{
+		oldbuilds,
+		oldprojects,
+		oldsteps,
+		oldcache,
+		oldcontainers,
+	}
+
+	var ignoreFile, _ = gitignore.NewGitIgnore(options.IgnoreFilePath())
+
+	// Make sure we don't accidentally recurse or copy extra files
+	return func(src string, files []os.FileInfo) []string {
+		ignores := []string{}
+		for _, file := range files {
+			abspath, err := filepath.Abs(filepath.Join(src, file.Name()))
+			if err != nil {
+				// Something went sufficiently wrong
+				panic(errors.Wrapf(err, "could not create absolute path for %s/%s", src, file.Name()))
+			}
+			if util.ContainsString(ignoreFiles, abspath) || (ignoreFile != nil && ignoreFile.Match(abspath, file.IsDir())) {
+				ignores = append(ignores, file.Name())
+			}
+
+			// TODO(termie): remove this warning after a while
+			if util.ContainsString(deprecatedPaths, abspath) {
+				logger.Warnln(fmt.Sprintf("Not ignoring deprecated runtime path, %s. You probably want to delete it so it doesn't get copied into your container. Runtime files are now stored under '.wercker' by default. This message will go away in a future update.", file.Name()))
+			}
+		}
+		return ignores
+	}
+}
+
 // CleanupOldBuilds removes old builds and keeps the latest 2
 func (p *Runner) CleanupOldBuilds() error {
 	// how many recent builds to keep
@@ -285,26 +309,47 @@ func (p *Runner) CleanupOldBuilds() error {
 	return nil
 }
 
+// readWerckerYaml returns the path and bytes of the wercker.yml in the
+// ProjectDir. Without one a default is generated once the code is copied,
+// and kept so it is only detected and printed once.
+func (p *Runner) readWerckerYaml() (string, []byte, error) {
+	if p.defaultYaml != nil {
+		return p.defaultYamlFile, p.defaultYaml, nil
+	}
+	yamlFile, werckerYaml, err := core.ReadWerckerYaml([]string{p.ProjectDir()}, false)
+	if err == nil || !p.codeCopied {
+		return yamlFile, werckerYaml, err
+	}
+	yamlFile, werckerYaml, err = core.ReadWerckerYaml([]string{p.ProjectDir()}, true)
+	if err != nil {
+		return "", nil, err
+	}
+	p.defaultYamlFile, p.defaultYaml = yamlFile, werckerYaml
+	return yamlFile, werckerYaml, nil
+}
+
 // GetConfig parses and returns the wercker.yml file.
 func (p *Runner) GetConfig() (*core.Config, string, error) {
 	// Return a []byte of the yaml we find or create.
 	var werckerYaml []byte
 	var err error
-	if p.options.WerckerYml != "" {
-		werckerYaml, err = ioutil.ReadFile(p.options.WerckerYml)
+	// Included files are relative to the wercker.yml
+	yamlFile := p.options.WerckerYml
+	if yamlFile != "" {
+		werckerYaml, err = ioutil.ReadFile(yamlFile)
 		if err != nil {
 			return nil, "", errors.Wrapf(err, "could not read file %s while getting configuration",
 				p.options.WerckerYml)
 		}
 	} else {
-		werckerYaml, err = core.ReadWerckerYaml([]string{p.ProjectDir()}, false)
+		yamlFile, werckerYaml, err = p.readWerckerYaml()
 		if err != nil {
 			return nil, "", errors.Wrap(err, "could not read wercker yml while getting config")
 		}
 	}
 
 	// Parse that bad boy.
-	rawConfig, err := core.ConfigFromYaml(werckerYaml)
+	rawConfig, err := core.ConfigFromYamlFile(yamlFile, werckerYaml)
 	if err != nil {
 		return nil, "", errors.Wrapf(err, "could not get configuration from yaml %s", werckerYaml)
 	}
@@ -334,6 +379,12 @@ func (p *Runner) GetConfig() (*core.Config, string, error) {
 		p.logger.Debugln("NoReponseTimeout set in config, new NoReponseTimeout:", noResponseTimeout)
 	}
 
+	// The pipeline timeout is a wall-clock limit for the whole pipeline
+	if pipelineConfig, ok := rawConfig.PipelinesMap[p.options.Pipeline]; ok && pipelineConfig != nil && pipelineConfig.Timeout > 0 {
+		p.options.PipelineTimeout = pipelineConfig.Timeout * 60 * 1000 // convert to milliseconds
+		p.logger.Debugln("Pipeline timeout set in config, new PipelineTimeout:", pipelineConfig.Timeout)
+	}
+
 	return rawConfig, string(werckerYaml), nil
 }
 
@@ -440,9 +491,15 @@ type RunnerShared struct {
 
 // StartStep emits BuildStepStarted and returns a Finisher for the end event.
 func (p *Runner) StartStep(ctx *RunnerShared, step core.Step, order int) *util.Finisher {
+	return p.startStep(ctx, step, nil, order)
+}
+
+// startStep is StartStep for a step that may run in a parallel group
+func (p *Runner) startStep(ctx *RunnerShared, step core.Step, group core.Step, order int) *util.Finisher {
 	p.emitter.Emit(core.BuildStepStarted, &core.BuildStepStartedArgs{
 		Box:   ctx.box,
 		Step:  step,
+		Group: group,
 		Order: order,
 	})
 	return util.NewFinisher(func(result interface{}) {
@@ -453,11 +510,17 @@ func (p *Runner) StartStep(ctx *RunnerShared, step core.Step, order int) *util.F
 		}
 		p.emitter.Emit(core.BuildStepFinished, &core.BuildStepFinishedArgs{
 			Box:                 ctx.box,
+			Step:                step,
+			Group:               group,
+			Order:               order,
 			Successful:          r.Success,
+			Skipped:             r.Skipped,
 			Message:             r.Message,
 			ArtifactURL:         artifactURL,
 			PackageURL:          r.PackageURL,
 			WerckerYamlContents: r.WerckerYamlContents,
+			Attempts:            r.Attempts,
+			ExitCode:            r.ExitCode,
 		})
 	})
 }
@@ -783,6 +846,136 @@ func (p *Runner) SetupEnvironment(runnerCtx context.Context) (*RunnerShared, err
 	return shared, nil
 }
 
+// SetupFailureEnvironment gets a box ready to run the after-steps of a
+// pipeline when SetupEnvironment failed, so failure notifications still go
+// out. The box of the pipeline is used when it could be fetched, otherwise
+// the FailureBox is.
+func (p *Runner) SetupFailureEnvironment(runnerCtx context.Context, shared *RunnerShared) (*RunnerShared, error) {
+	if shared == nil || shared.pipeline == nil {
+		return nil, fmt.Errorf("the pipeline could not be loaded")
+	}
+	pipeline := shared.pipeline
+
+	box := shared.box
+	if box == nil {
+		p.logger.Debugln("Using failure box", p.options.FailureBox)
+		failureBox, err := dockerlocal.NewDockerBox(&core.BoxConfig{ID: p.options.FailureBox}, p.options, p.dockerOptions)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating the failure box")
+		}
+		if _, err := failureBox.Fetch(runnerCtx, pipeline.Env()); err != nil {
+			return nil, errors.Wrapf(err, "error fetching the failure box %s", p.options.FailureBox)
+		}
+		box = failureBox
+	}
+
+	// A box that is already running is restarted for a fresh shell, like it
+	// is for the after-steps of a pipeline that ran
+	containerID := shared.containerID
+	if containerID != "" && shared.box == box {
+		if _, err := box.Restart(); err != nil {
+			return nil, errors.Wrap(err, "error restarting the box")
+		}
+	} else {
+		container, err := box.Run(runnerCtx, pipeline.Env(), "")
+		if err != nil {
+			return nil, errors.Wrap(err, "error running the box")
+		}
+		containerID = container.ID
+	}
+
+	failureShared := &RunnerShared{
+		box:         box,
+		pipeline:    pipeline,
+		config:      shared.config,
+		containerID: containerID,
+	}
+
+	for _, step := range pipeline.AfterStepsFor(false) {
+		if _, err := step.Fetch(); err != nil {
+			return failureShared, errors.Wrap(err, "error fetching after-step")
+		}
+	}
+
+	sessionCtx, sess, err := p.GetSession(runnerCtx, containerID)
+	if err != nil {
+		return failureShared, errors.Wrap(err, "error attaching session to box")
+	}
+	failureShared.sess = sess
+	failureShared.sessionCtx = sessionCtx
+
+	// The source may not have been copied yet, the steps still run without it
+	if err := pipeline.SetupGuest(sessionCtx, sess); err != nil {
+		p.logger.Warnln("Unable to set up guest for after-steps:", err)
+	}
+	if err := pipeline.ExportEnvironment(sessionCtx, sess); err != nil {
+		return failureShared, errors.Wrap(err, "error exporting environment")
+	}
+	return failureShared, nil
+}
+
+// RunAfterSteps runs the after-steps that apply to the result of the steps in
+// a fresh session. The ones that do not apply are reported as skipped so
+// they do not show up as pending.
+func (p *Runner) RunAfterSteps(ctx context.Context, shared *RunnerShared, pr *core.PipelineResult, stepCounter *util.Counter) error {
+	f := p.formatter
+	pipeline := shared.pipeline
+
+	// Add the After-Step parts
+	err := pr.ExportEnvironment(shared.sessionCtx, shared.sess)
+	if err != nil {
+		return err
+	}
+	// Make the result available to `when` conditions on after-steps
+	pipeline.Env().Update(pr.Env().Ordered())
+
+	selected := map[core.Step]bool{}
+	for _, step := range pipeline.AfterStepsFor(pr.Success) {
+		selected[step] = true
+	}
+
+	failed := false
+	timer := util.NewTimer()
+	for _, step := range pipeline.AfterSteps() {
+		if failed || !selected[step] {
+			message := "Skipped, pipeline failed"
+			if pr.Success {
+				message = "Skipped, pipeline passed"
+			}
+			if failed {
+				message = "Skipped, after-step failed"
+			}
+			p.SkipStep(shared, step, stepCounter.Increment(), message)
+			continue
+		}
+
+		p.logger.Println(f.Info("Running after-step", step.DisplayName()))
+		timer.Reset()
+		sr, err := p.RunStep(ctx, shared, step, stepCounter.Increment())
+		if err != nil {
+			p.logger.Println(f.Fail("After-step failed", step.DisplayName(), timer.String()))
+			failed = !step.AllowFailure()
+			continue
+		}
+		if sr.Skipped {
+			p.logger.Println(f.Info("Skipped after-step", step.DisplayName(), sr.Message))
+			continue
+		}
+		p.logger.Println(f.Success("After-step passed", step.DisplayName(), timer.String()))
+	}
+	return nil
+}
+
+// SkipStep reports a step that does not run as started and finished
+func (p *Runner) SkipStep(shared *RunnerShared, step core.Step, order int, message string) {
+	finisher := p.StartStep(shared, step, order)
+	finisher.Finish(&StepResult{
+		Success: true,
+		Skipped: true,
+		Message: message,
+	})
+}
+
 // StepResult holds the info we need to report on steps
 type StepResult struct {
 	Success             bool
@@ -791,6 +984,8 @@ type StepResult struct {
 	Message             string
 	ExitCode            int
 	WerckerYamlContents string
+	Skipped             bool
+	Attempts            int
 }
 
 // RunStep runs a step and tosses error if it fails
@@ -804,6 +999,23 @@ func (p *Runner) RunStep(ctx context.Context, shared *RunnerShared, step core.St
 	}
 	defer finisher.Finish(sr)
 
+	// Steps with a `when` condition only run if it is met, skipped steps still
+	// report as started and finished so they show up in the step list
+	if step.When() != "" {
+		run, err := core.EvaluateCondition(step.When(), shared.pipeline.Env())
+		if err != nil {
+			sr.Message = err.Error()
+			return sr, err
+		}
+		if !run {
+			sr.Success = true
+			sr.Skipped = true
+			sr.ExitCode = 0
+			sr.Message = fmt.Sprintf("Skipped, condition not met: %s", step.When())
+			return sr, nil
+		}
+	}
+
 	if step.ShouldSyncEnv() {
 		err := shared.pipeline.SyncEnvironment(shared.sessionCtx, shared.sess)
 		if err != nil {
@@ -825,7 +1037,13 @@ func (p *Runner) RunStep(ctx context.Context, shared *RunnerShared, step core.St
 
 	// we need to keep this err for a while, so giving it a unique name to prevent
 	// accidentally overwriting it
-	exit, execErr := step.Execute(shared.sessionCtx, shared.sess)
+	var exit int
+	var execErr error
+	if group, ok := step.(*core.ParallelStep); ok {
+		exit, execErr = p.runParallel(ctx, shared, group, order)
+	} else {
+		exit, execErr = p.executeStep(withStepTimeouts(shared.sessionCtx, step), shared.sess, step, sr)
+	}
 	if exit != 0 {
 		sr.ExitCode = exit
 		if p.options.AttachOnError {
@@ -840,12 +1058,34 @@ func (p *Runner) RunStep(ctx context.Context, shared *RunnerShared, step core.St
 		sr.ExitCode = 0
 	}
 
+	if err := p.collectStepResults(ctx, shared, step, sr); err != nil {
+		return sr, err
+	}
+
+	// This is the error from the step.Execute above
+	if execErr != nil {
+		if sr.Message == "" {
+			sr.Message = execErr.Error()
+		}
+		return sr, execErr
+	}
+
+	if !sr.Success {
+		return sr, fmt.Errorf("Step failed with exit code: %d", sr.ExitCode)
+	}
+
+	return sr, nil
+}
+
+// collectStepResults grabs the message of a step that ran and its artifacts
+// when we want them
+func (p *Runner) collectStepResults(ctx context.Context, shared *RunnerShared, step core.Step, sr *StepResult) error {
 	// Grab the message
 	var message bytes.Buffer
 	messageErr := step.CollectFile(shared.containerID, step.ReportPath(), "message.txt", &message)
 	if messageErr != nil {
 		if messageErr != util.ErrEmptyTarball {
-			return sr, errors.Wrapf(messageErr, "error collecting file for container %s and path %s",
+			return errors.Wrapf(messageErr, "error collecting file for container %s and path %s",
 				shared.containerID, step.ReportPath())
 		}
 	}
@@ -855,30 +1095,239 @@ func (p *Runner) RunStep(ctx context.Context, shared *RunnerShared, step core.St
 	if p.options.ShouldArtifacts {
 		artifact, err := step.CollectArtifact(ctx, shared.containerID)
 		if err != nil {
-			return sr, errors.Wrapf(err, "error collecting artifacts for %s", shared.containerID)
+			return errors.Wrapf(err, "error collecting artifacts for %s", shared.containerID)
 		}
 
 		if artifact != nil && p.options.ShouldStore {
 			artificer := dockerlocal.NewArtificer(p.options, p.dockerOptions)
 			err = artificer.Upload(artifact)
 			if err != nil {
-				return sr, errors.Wrap(err, "error creating new artificer")
+				return errors.Wrap(err, "error creating new artificer")
 			}
 		}
 		sr.Artifact = artifact
 	}
+	return nil
+}
 
-	// This is the error from the step.Execute above
-	if execErr != nil {
-		if sr.Message == "" {
-			sr.Message = execErr.Error()
+// withStepTimeouts lets a step override the command timeouts for its own
+// commands
+func withStepTimeouts(ctx context.Context, step core.Step) context.Context {
+	if step.Timeout() > 0 || step.NoResponseTimeout() > 0 {
+		return core.WithCommandTimeouts(ctx, step.Timeout()*60*1000, step.NoResponseTimeout()*60*1000)
+	}
+	return ctx
+}
+
+// executeStep runs the step in the session, running it again as long as it
+// fails and its RetryConfig allows, and records the attempts in sr
+func (p *Runner) executeStep(ctx context.Context, sess *core.Session, step core.Step, sr *StepResult) (int, error) {
+	retry := step.Retry()
+	for attempt := 1; ; attempt++ {
+		sr.Attempts = attempt
+		exit, err := step.Execute(ctx, sess)
+		if exit == 0 && err == nil {
+			if attempt > 1 {
+				p.emitter.Emit(core.Logs, &core.LogsArgs{
+					Logs: fmt.Sprintf("\nStep %s passed on attempt %d of %d\n", step.DisplayName(), attempt, retry.Attempts),
+				})
+			}
+			return exit, err
+		}
+		if ctx.Err() != nil || !retry.ShouldRetry(attempt, exit) {
+			if retry != nil {
+				p.emitter.Emit(core.Logs, &core.LogsArgs{
+					Logs: fmt.Sprintf("\nStep %s failed with exit code %d on attempt %d of %d, not retrying\n", step.DisplayName(), exit, attempt, retry.Attempts),
+				})
+			}
+			return exit, err
+		}
+
+		delay := retry.Backoff(attempt)
+		p.emitter.Emit(core.Logs, &core.LogsArgs{
+			Logs: fmt.Sprintf("\nStep %s failed with exit code %d on attempt %d of %d, retrying in %s\n",
+				step.DisplayName(), exit, attempt, retry.Attempts, delay),
+		})
+		p.logger.Debugln("Retrying step", step.SafeID(), "attempt", attempt+1)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return exit, err
 		}
-		return sr, execErr
 	}
+}
 
-	if !sr.Success {
-		return sr, fmt.Errorf("Step failed with exit code: %d", sr.ExitCode)
+// runParallel runs the steps of a parallel group at the same time, each in a
+// shell of its own in the box container. The group fails if any of its steps
+// fails, unless that step is allowed to fail. Changes the steps make to their
+// environment stay in their own shell. The steps report as steps of their own
+// with the order of the group.
+func (p *Runner) runParallel(ctx context.Context, shared *RunnerShared, group *core.ParallelStep, order int) (int, error) {
+	steps := group.Steps()
+	exits := make([]int, len(steps))
+	errs := make([]error, len(steps))
+
+	// Sessions are prepared one at a time since that sets up wercker-init
+	// in the container again
+	var prepare sync.Mutex
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step core.Step) {
+			defer wg.Done()
+			exits[i], errs[i] = p.runParallelStep(ctx, shared, group, step, order, &prepare)
+		}(i, step)
 	}
+	wg.Wait()
 
-	return sr, nil
+	exit := 0
+	failed := []string{}
+	for i, step := range steps {
+		if exits[i] == 0 && errs[i] == nil {
+			continue
+		}
+		if step.AllowFailure() {
+			p.logger.Warnln("Parallel step failed, but is allowed to fail:", step.DisplayName())
+			continue
+		}
+		failed = append(failed, step.DisplayName())
+		if exit == 0 {
+			exit = exits[i]
+		}
+	}
+	if len(failed) > 0 {
+		if exit == 0 {
+			exit = 1
+		}
+		return exit, fmt.Errorf("Parallel steps failed: %s", strings.Join(failed, ", "))
+	}
+	return 0, nil
+}
+
+// runParallelStep runs a single step of a parallel group in a new session,
+// its output is prefixed with its name
+func (p *Runner) runParallelStep(ctx context.Context, shared *RunnerShared, group core.Step, step core.Step, order int, prepare *sync.Mutex) (int, error) {
+	finisher := p.startStep(shared, step, group, order)
+	sr := &StepResult{
+		Success:  false,
+		Artifact: nil,
+		Message:  "",
+		ExitCode: 1,
+	}
+	defer finisher.Finish(sr)
+	prefix := fmt.Sprintf("[%s] ", step.DisplayName())
+
+	if step.When() != "" {
+		run, err := core.EvaluateCondition(step.When(), shared.pipeline.Env())
+		if err != nil {
+			sr.Message = err.Error()
+			return sr.ExitCode, err
+		}
+		if !run {
+			sr.Success = true
+			sr.Skipped = true
+			sr.ExitCode = 0
+			sr.Message = fmt.Sprintf("Skipped, condition not met: %s", step.When())
+			p.emitter.Emit(core.Logs, &core.LogsArgs{
+				Logs: prefix + sr.Message + "\n",
+			})
+			return sr.ExitCode, nil
+		}
+	}
+
+	sessionCtx, sess, err := p.GetExecSession(shared.sessionCtx, shared.box, shared.containerID)
+	if err != nil {
+		sr.Message = err.Error()
+		return sr.ExitCode, err
+	}
+	// Closing the shell ends the exec
+	defer sess.Send(sessionCtx, true, "exit")
+	sess.SetLogPrefix(prefix)
+
+	prepare.Lock()
+	err = p.prepareSession(sessionCtx, shared, sess)
+	prepare.Unlock()
+	if err != nil {
+		sr.Message = err.Error()
+		return sr.ExitCode, errors.Wrapf(err, "error preparing session for %s", step.DisplayName())
+	}
+
+	if err := step.InitEnv(ctx, shared.pipeline.Env()); err != nil {
+		sr.Message = err.Error()
+		return sr.ExitCode, fmt.Errorf("Step initEnv failed with error message: %s", err.Error())
+	}
+
+	exit, execErr := p.executeStep(withStepTimeouts(sessionCtx, step), sess, step, sr)
+	if exit != 0 {
+		sr.ExitCode = exit
+	} else if execErr == nil {
+		sr.Success = true
+		sr.ExitCode = 0
+	}
+	if sr.Success {
+		p.emitter.Emit(core.Logs, &core.LogsArgs{
+			Logs: fmt.Sprintf("%sStep passed\n", prefix),
+		})
+	} else {
+		p.emitter.Emit(core.Logs, &core.LogsArgs{
+			Logs: fmt.Sprintf("%sStep failed with exit code %d\n", prefix, exit),
+		})
+	}
+
+	if err := p.collectStepResults(ctx, shared, step, sr); err != nil {
+		return sr.ExitCode, err
+	}
+	if execErr != nil && sr.Message == "" {
+		sr.Message = execErr.Error()
+	}
+	return sr.ExitCode, execErr
+}
+
+// GetExecSession starts a new shell in the box container and attaches a
+// session to it. Unlike the sessions from GetSession it does not share the
+// shell of the main session, so commands can run in it at the same time.
+func (p *Runner) GetExecSession(runnerContext context.Context, box core.Box, containerID string) (context.Context, *core.Session, error) {
+	dockerBox, ok := box.(*dockerlocal.DockerBox)
+	if !ok {
+		return nil, nil, fmt.Errorf("parallel steps need a docker box")
+	}
+	cmd, err := dockerBox.ShellCommand()
+	if err != nil {
+		return nil, nil, err
+	}
+	dockerTransport, err := dockerlocal.NewDockerExecTransport(p.options, p.dockerOptions, containerID, cmd)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not create docker transport for %s", containerID)
+	}
+	sess := core.NewSession(p.options, dockerTransport)
+	sessionCtx, err := sess.Attach(runnerContext)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not attach to session for %s", containerID)
+	}
+	return sessionCtx, sess, nil
+}
+
+// prepareSession gives a new session the environment of the pipeline and the
+// functions wercker-init makes available to steps
+func (p *Runner) prepareSession(sessionCtx context.Context, shared *RunnerShared, sess *core.Session) error {
+	err := shared.pipeline.ExportEnvironment(sessionCtx, sess)
+	if err != nil {
+		return err
+	}
+
+	steps := shared.pipeline.Steps()
+	if len(steps) == 0 || steps[0].Name() != "wercker-init" {
+		return nil
+	}
+	sess.HideLogs()
+	defer sess.ShowLogs()
+	exit, err := steps[0].Execute(sessionCtx, sess)
+	if err != nil {
+		return err
+	}
+	if exit != 0 {
+		return fmt.Errorf("wercker-init failed with exit code: %d", exit)
+	}
+	return nil
 }
@@ -17,6 +17,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -84,6 +87,10 @@ func (s *MockPipeline) CollectCache(context.Context, string) error {
 	return nil
 }
 
+func (s *MockPipeline) CollectOutputs(context.Context, string) error {
+	return nil
+}
+
 func (s *MockPipeline) DockerMessage() string {
 	return ""
 }
@@ -125,3 +132,25 @@ func (s *RunnerSuite) TestRunnerStepFailedOnInitEnvError() {
 	s.Equal(sr.Message, initEnvErrorMessage)
 	s.NotEqual(sr.ExitCode, 0)
 }
+
+func (s *RunnerSuite) TestRunnerDefaultConfigAfterCopy() {
+	dir := s.WorkingDir()
+	s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte{}, 0644))
+	runner := &Runner{options: &core.PipelineOptions{DirectMount: true, ProjectPath: dir}}
+
+	_, _, err := runner.readWerckerYaml()
+	s.NotNil(err)
+
+	_, err = runner.EnsureCode()
+	s.Require().Nil(err)
+	yamlFile, werckerYaml, err := runner.readWerckerYaml()
+	s.Require().Nil(err)
+	s.Equal(filepath.Join(dir, "wercker.yml"), yamlFile)
+	s.Equal(string(core.DefaultConfigYaml("golang")), string(werckerYaml))
+
+	// The default is kept instead of being detected again
+	s.Require().Nil(os.Remove(filepath.Join(dir, "main.go")))
+	_, again, err := runner.readWerckerYaml()
+	s.Require().Nil(err)
+	s.Equal(string(werckerYaml), string(again))
+}
@@ -0,0 +1,162 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wercker/wercker/core"
+)
+
+// cmdRunsList prints the runs recorded in the working dir, the latest first
+func cmdRunsList(opts *core.RunsOptions) error {
+	records, err := core.LoadRunRecords(opts.WorkingDir)
+	if err != nil {
+		return err
+	}
+	records = filterRuns(records, opts)
+	if len(records) == 0 {
+		fmt.Println("No runs found")
+		return nil
+	}
+	return writeRuns(os.Stdout, records)
+}
+
+// cmdRunsShow prints a run recorded in the working dir, and its logs when
+// asked for
+func cmdRunsShow(opts *core.RunsOptions) error {
+	record, err := core.LoadRunRecord(opts.WorkingDir, opts.RunID)
+	if err != nil {
+		return err
+	}
+	if err := writeRun(os.Stdout, record); err != nil {
+		return err
+	}
+	if !opts.Logs {
+		return nil
+	}
+
+	fmt.Println("\nLogs:")
+	return cmdLogs(&core.LogsOptions{
+		GlobalOptions: opts.GlobalOptions,
+		WorkingDir:    opts.WorkingDir,
+		RunID:         record.RunID,
+	})
+}
+
+// filterRuns returns the records matching the filters of opts, at most
+// opts.Limit of them
+func filterRuns(records []*core.RunRecord, opts *core.RunsOptions) []*core.RunRecord {
+	filtered := []*core.RunRecord{}
+	for _, record := range records {
+		if opts.Pipeline != "" && record.Pipeline != opts.Pipeline {
+			continue
+		}
+		if opts.Branch != "" && record.Git.Branch != opts.Branch {
+			continue
+		}
+		if opts.Result != "" && record.Result != opts.Result {
+			continue
+		}
+		if opts.Limit > 0 && len(filtered) == opts.Limit {
+			break
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered
+}
+
+// writeRuns writes the records to w as a table
+func writeRuns(w io.Writer, records []*core.RunRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN ID\tPIPELINE\tBRANCH\tRESULT\tSTARTED\tDURATION")
+	for _, record := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.RunID,
+			record.Pipeline,
+			record.Git.Branch,
+			record.Result,
+			record.Started.Format("2006-01-02 15:04:05"),
+			formatDuration(record.Duration()),
+		)
+	}
+	return tw.Flush()
+}
+
+// writeRun writes the details and the steps of record to w
+func writeRun(w io.Writer, record *core.RunRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Run:\t%s\n", record.RunID)
+	fmt.Fprintf(tw, "Pipeline:\t%s\n", record.Pipeline)
+	fmt.Fprintf(tw, "Result:\t%s\n", record.Result)
+	if record.AfterStepsResult != "" {
+		fmt.Fprintf(tw, "After-steps:\t%s\n", record.AfterStepsResult)
+	}
+	if record.Git.Branch != "" {
+		fmt.Fprintf(tw, "Branch:\t%s\n", record.Git.Branch)
+	}
+	if record.Git.Commit != "" {
+		fmt.Fprintf(tw, "Commit:\t%s\n", record.Git.Commit)
+	}
+	fmt.Fprintf(tw, "Started:\t%s\n", record.Started.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(tw, "Duration:\t%s\n", formatDuration(record.Duration()))
+	if record.OutputPath != "" {
+		fmt.Fprintf(tw, "Output:\t%s\n", record.OutputPath)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nSteps:")
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tRESULT\tEXIT CODE\tDURATION\tARTIFACT")
+	for _, step := range record.Steps {
+		artifact := step.ArtifactURL
+		if step.PackageURL != "" {
+			artifact = step.PackageURL
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+			step.DisplayName,
+			step.Result,
+			step.ExitCode,
+			formatDuration(step.Duration()),
+			artifact,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if record.WerckerYml != "" {
+		fmt.Fprintln(w, "\nwercker.yml:")
+		for _, line := range strings.Split(strings.TrimRight(record.WerckerYml, "\n"), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	return nil
+}
+
+// formatDuration rounds d to make it readable
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
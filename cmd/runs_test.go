@@ -0,0 +1,90 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+type RunsSuite struct {
+	*util.TestSuite
+}
+
+func TestRunsSuite(t *testing.T) {
+	suiteTester := &RunsSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *RunsSuite) testRecords() []*core.RunRecord {
+	return []*core.RunRecord{
+		{RunID: "run4", Pipeline: "build", Result: "failed", Git: core.RunGit{Branch: "feature"}},
+		{RunID: "run3", Pipeline: "deploy", Result: "passed", Git: core.RunGit{Branch: "master"}},
+		{RunID: "run2", Pipeline: "build", Result: "passed", Git: core.RunGit{Branch: "master"}},
+		{RunID: "run1", Pipeline: "build", Result: "passed", Git: core.RunGit{Branch: "feature"}},
+	}
+}
+
+func (s *RunsSuite) TestFilterRuns() {
+	tests := []struct {
+		opts     *core.RunsOptions
+		expected []string
+	}{
+		{&core.RunsOptions{}, []string{"run4", "run3", "run2", "run1"}},
+		{&core.RunsOptions{Limit: 2}, []string{"run4", "run3"}},
+		{&core.RunsOptions{Pipeline: "build"}, []string{"run4", "run2", "run1"}},
+		{&core.RunsOptions{Branch: "master"}, []string{"run3", "run2"}},
+		{&core.RunsOptions{Pipeline: "build", Result: "passed"}, []string{"run2", "run1"}},
+		{&core.RunsOptions{Pipeline: "build", Result: "passed", Limit: 1}, []string{"run2"}},
+		{&core.RunsOptions{Pipeline: "test"}, []string{}},
+	}
+
+	for _, test := range tests {
+		ids := []string{}
+		for _, record := range filterRuns(s.testRecords(), test.opts) {
+			ids = append(ids, record.RunID)
+		}
+		s.Equal(test.expected, ids)
+	}
+}
+
+func (s *RunsSuite) TestWriteRun() {
+	started := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	finished := started.Add(2 * time.Minute)
+	record := &core.RunRecord{
+		RunID:      "run1",
+		Pipeline:   "build",
+		Result:     "failed",
+		Started:    started,
+		Finished:   &finished,
+		Git:        core.RunGit{Branch: "master", Commit: "7d3f1c2"},
+		WerckerYml: "box: golang\nbuild:\n  steps:\n    - script:\n        code: go test\n",
+		Steps: []*core.StepRecord{
+			{DisplayName: "go test", Result: "failed", ExitCode: 2, Started: started, Finished: &finished},
+		},
+	}
+
+	var out bytes.Buffer
+	s.Nil(writeRun(&out, record))
+	s.Contains(out.String(), "Commit:    7d3f1c2")
+	s.Contains(out.String(), "Duration:  2m0s")
+	s.Contains(out.String(), "go test  failed  2")
+	s.Contains(out.String(), "\n  box: golang\n")
+}
@@ -1,22 +1,27 @@
 package cmd
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
+	"github.com/termie/go-shutil"
 	"github.com/wercker/wercker/core"
 	"github.com/wercker/wercker/docker"
 	"github.com/wercker/wercker/util"
+	"golang.org/x/crypto/ssh/terminal"
 	"golang.org/x/net/context"
 	"gopkg.in/mgo.v2/bson"
 )
 
 // cmdWorkflow is the main driver for running a workflow.
 func cmdWorkflow(ctx context.Context, opts *core.WorkflowOptions, dockerOptions *dockerlocal.Options) error {
-	// PipelineName->RunId map to keep track of which pipelines have ran
-	// and their runIDs.
-	pipelineRunMap := map[string]string{}
+	logger := util.RootLogger().WithField("Logger", "Main")
 
 	config, err := getConfig(opts)
 	if err != nil {
@@ -33,29 +38,314 @@ func cmdWorkflow(ctx context.Context, opts *core.WorkflowOptions, dockerOptions
 		return errors.Wrap(err, "invalid workflow")
 	}
 
-	for {
-		pipeline, sourceRunIDs := nextPipeline(workflow, pipelineRunMap)
-		if pipeline == nil {
-			// Done with the workflow, no more pipelines to execute.
-			break
+	if opts.Plan {
+		graph, err := newWorkflowGraph(workflow, dockerPipelineDescriber(config, &opts.PipelineOptions, dockerOptions))
+		if err != nil {
+			return err
+		}
+		for _, line := range graph.Plan() {
+			logger.Println(line)
 		}
+		return nil
+	}
 
-		pipelineOpts, err := getPipelineOptions(opts, pipeline, sourceRunIDs, pipelineRunMap)
+	var state *workflowState
+	if opts.Resume != "" {
+		state, err = loadWorkflowState(&opts.PipelineOptions, opts.Resume)
 		if err != nil {
 			return err
 		}
+		if state.Workflow != opts.WorkflowName {
+			return errors.Errorf("workflow run %s is a run of workflow %s, not %s", opts.Resume, state.Workflow, opts.WorkflowName)
+		}
+		logger.Println("Resuming workflow run", state.ID)
+		for _, pipeline := range workflow.Pipelines {
+			if runID, ok := state.passed()[pipeline.Name]; ok {
+				logger.Println("Reusing pipeline", pipeline.Name, "from run", runID)
+			}
+		}
+	} else {
+		state = newWorkflowState(&opts.PipelineOptions, bson.NewObjectId().Hex(), opts.WorkflowName)
+		logger.Println("Starting workflow run", state.ID)
+	}
+
+	// The changed files come from the project itself, not from the copy
+	// the pipelines run on
+	var changed []string
+	if hasPathFilters(workflow) && opts.PipelineOptions.ProjectURL == "" {
+		changed, err = changedFiles(opts.PipelineOptions.ProjectPath, opts.BaseRef)
+		if err != nil {
+			if opts.BaseRef != "" {
+				return errors.Wrapf(err, "unable to find the files changed since %s", opts.BaseRef)
+			}
+			logger.Warnln("Unable to find the changed files, the path filters are ignored:", err)
+		}
+	}
+	skipped := skippedPipelines(workflow, opts.PipelineOptions.GitBranch, changed)
+	for _, pipeline := range workflow.Pipelines {
+		if reason, ok := skipped[pipeline.Name]; ok {
+			logger.Println("Skipping pipeline", pipeline.Name+",", reason)
+		}
+	}
+	if err := state.skip(skipped); err != nil {
+		return errors.Wrap(err, "unable to save the state of the workflow run")
+	}
 
-		runID, err := runPipeline(ctx, pipelineOpts, dockerOptions)
+	// Every root pipeline starts from the same copy of the project, so they
+	// all build the same source even if it changes while the workflow runs
+	if !opts.PipelineOptions.DirectMount && opts.PipelineOptions.ProjectURL == "" {
+		source, err := workflowSource(&opts.PipelineOptions, state.ID, logger)
 		if err != nil {
 			return err
 		}
+		opts.PipelineOptions.ProjectPath = source
+	}
 
-		pipelineRunMap[pipeline.Name] = runID
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		pipelineOpts, err := getPipelineOptions(opts, pipeline, sourceRunIDs, pipelineRunMap)
+		if err != nil {
+			return "", err
+		}
+		if opts.MaxParallel != 1 {
+			pipelineOpts.LogPrefix = pipeline.Name
+		}
+		dockerOpts := *dockerOptions
+		return runPipeline(ctx, pipelineOpts, &dockerOpts)
+	}
+	err = runWorkflow(ctx, workflow, state, opts.MaxParallel, opts.KeepGoing, run, workflowApproval(opts))
+	if err != nil {
+		logger.Println("Resume the workflow from the failed pipelines with: wercker workflow --resume", state.ID, opts.WorkflowName)
+		return err
 	}
 
+	waiting := []string{}
+	for _, pipeline := range workflow.Pipelines {
+		if state.waiting()[pipeline.Name] {
+			waiting = append(waiting, pipeline.Name)
+		}
+	}
+	if len(waiting) > 0 {
+		logger.Println("The workflow stopped at the approval of", strings.Join(waiting, ", "))
+		logger.Println("Approve and continue the workflow with: wercker workflow --resume", state.ID, opts.WorkflowName)
+	}
 	return nil
 }
 
+// workflowApproval returns the approver for the pipelines of a local workflow
+// that need approval, it asks unless opts says what to do
+func workflowApproval(opts *core.WorkflowOptions) workflowApprover {
+	logger := util.RootLogger().WithField("Logger", "Main")
+	// Pipelines running side by side ask one after the other
+	var mutex sync.Mutex
+	return func(pipeline *core.WorkflowPipelineConfig) (bool, error) {
+		if opts.AutoApprove {
+			logger.Println("Auto-approved pipeline", pipeline.Name)
+			return true, nil
+		}
+		if opts.StopAtApproval {
+			return false, nil
+		}
+		if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+			return false, errors.Errorf("pipeline %s needs approval, use --auto-approve or --stop-at-approval when not running in a terminal", pipeline.Name)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if pipeline.ApprovalMessage != "" {
+			logger.Println(pipeline.ApprovalMessage)
+		}
+		logger.Println("Run pipeline", pipeline.Name, "now? (yes/no)")
+		if !askForConfirmation() {
+			return false, errPipelineRejected
+		}
+		return true, nil
+	}
+}
+
+// workflowPipelineRunner runs a pipeline of a workflow and returns its RunID
+type workflowPipelineRunner func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error)
+
+// workflowApprover tells whether a pipeline that needs approval may run now
+type workflowApprover func(pipeline *core.WorkflowPipelineConfig) (bool, error)
+
+// errPipelineRejected is returned by a workflowApprover when the pipeline was
+// rejected, unlike a pipeline that waits for approval resuming the workflow
+// run does not approve it
+var errPipelineRejected = errors.New("pipeline was rejected")
+
+// workflowRun is the outcome of a pipeline of a workflow
+type workflowRun struct {
+	pipeline *core.WorkflowPipelineConfig
+	runID    string
+	err      error
+	// waiting is set when the pipeline was not approved and did not run
+	waiting bool
+	// rejected is set when the pipeline was rejected and did not run
+	rejected bool
+}
+
+// runWorkflow runs every pipeline of workflow that did not pass in state yet
+// once the pipelines it requires have passed, at most maxParallel of them at
+// the same time. When a pipeline fails the running pipelines are cancelled
+// and no new ones are started, unless keepGoing is set, then every pipeline
+// that does not depend on the failed one still runs. The result of every
+// pipeline is recorded in state.
+//
+// A pipeline that needs approval only runs once approve says so, otherwise it
+// waits for approval: the pipelines that depend on it do not run, and
+// resuming the workflow run approves it. A pipeline approve rejects is asked
+// about again when the workflow run is resumed. approve may be nil to approve
+// everything.
+func runWorkflow(ctx context.Context, workflow *core.WorkflowConfig, state *workflowState, maxParallel int, keepGoing bool, run workflowPipelineRunner, approve workflowApprover) error {
+	logger := util.RootLogger().WithField("Logger", "Main")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// PipelineName->RunId map to keep track of which pipelines have ran
+	// and their runIDs.
+	pipelineRunMap := state.passed()
+	// The pipelines a resumed run stopped at are approved by resuming it
+	approved := state.waiting()
+	// Skipped pipelines are never started
+	started := state.skipped()
+	results := make(chan *workflowRun)
+	running := 0
+	failures := []error{}
+
+	for {
+		for len(failures) == 0 || keepGoing {
+			if maxParallel > 0 && running >= maxParallel {
+				break
+			}
+			pipeline, sourceRunIDs := nextPipeline(workflow, pipelineRunMap, started)
+			if pipeline == nil {
+				break
+			}
+			started[pipeline.Name] = true
+			running++
+
+			// The pipeline gets its own copy of the run map, the one here
+			// changes as other pipelines finish
+			runMap := make(map[string]string, len(pipelineRunMap))
+			for name, runID := range pipelineRunMap {
+				runMap[name] = runID
+			}
+			go func() {
+				if pipeline.Approval && !approved[pipeline.Name] && approve != nil {
+					ok, err := approve(pipeline)
+					if err == errPipelineRejected {
+						results <- &workflowRun{pipeline: pipeline, rejected: true}
+						return
+					}
+					if err != nil || !ok {
+						results <- &workflowRun{pipeline: pipeline, err: err, waiting: err == nil}
+						return
+					}
+				}
+				runID, err := run(ctx, pipeline, sourceRunIDs, runMap)
+				results <- &workflowRun{pipeline: pipeline, runID: runID, err: err}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+		result := <-results
+		running--
+		if err := state.record(result); err != nil {
+			logger.Errorln("Unable to save the state of the workflow run", err)
+		}
+		if result.waiting {
+			logger.Warnln("Pipeline", result.pipeline.Name, "is waiting for approval")
+			continue
+		}
+		if result.rejected {
+			logger.Warnln("Pipeline", result.pipeline.Name, "was rejected")
+			continue
+		}
+		if result.err != nil {
+			if len(failures) > 0 && !keepGoing {
+				logger.Warnln("Cancelled pipeline", result.pipeline.Name)
+				continue
+			}
+			logger.Errorln(result.err)
+			if !keepGoing {
+				cancel()
+			}
+			failures = append(failures, result.err)
+			continue
+		}
+		pipelineRunMap[result.pipeline.Name] = result.runID
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	for _, pipeline := range workflow.Pipelines {
+		if _, ok := pipelineRunMap[pipeline.Name]; !ok && !started[pipeline.Name] {
+			logger.Warnln("Skipped pipeline", pipeline.Name)
+		}
+	}
+	if len(failures) == 1 {
+		return failures[0]
+	}
+	return errors.Errorf("%d pipelines failed", len(failures))
+}
+
+// cmdWorkflowGraph prints the graph of a workflow without running it
+func cmdWorkflowGraph(opts *core.WorkflowOptions, dockerOptions *dockerlocal.Options) error {
+	config, err := getConfig(opts)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the yml file")
+	}
+
+	workflow := config.GetWorkflow(opts.WorkflowName)
+	if workflow == nil {
+		return errors.Errorf("%s does not contain workflow %s", opts.PipelineOptions.WerckerYml, opts.WorkflowName)
+	}
+	if err := workflow.Validate(config); err != nil {
+		return errors.Wrap(err, "invalid workflow")
+	}
+
+	graph, err := newWorkflowGraph(workflow, dockerPipelineDescriber(config, &opts.PipelineOptions, dockerOptions))
+	if err != nil {
+		return err
+	}
+	rendered, err := graph.Render(opts.GraphFormat)
+	if err != nil {
+		return err
+	}
+	fmt.Print(rendered)
+	return nil
+}
+
+// workflowSource copies the project for the workflow run id once, later calls
+// and resumed runs get the same copy
+func workflowSource(options *core.PipelineOptions, id string, logger *util.LogEntry) (string, error) {
+	source := options.WorkingPath("workflows", id, "source")
+	found, err := util.Exists(source)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return source, nil
+	}
+
+	// Copy next to the destination first so an interrupted copy is not
+	// mistaken for a complete one
+	tmp := fmt.Sprintf("%s-%s", source, uuid.NewRandom().String())
+	copyOpts := &shutil.CopyTreeOptions{Ignore: projectCopyIgnore(options, logger), CopyFunction: shutil.Copy, Symlinks: true}
+	if err := shutil.CopyTree(options.ProjectPath, tmp, copyOpts); err != nil {
+		os.RemoveAll(tmp)
+		return "", errors.Wrapf(err, "could not copy tree from %s to %s", options.ProjectPath, tmp)
+	}
+	if err := os.Rename(tmp, source); err != nil {
+		return "", err
+	}
+	return source, nil
+}
+
 func getConfig(opts *core.WorkflowOptions) (*core.Config, error) {
 	var werckerYaml []byte
 	var err error
@@ -63,18 +353,19 @@ func getConfig(opts *core.WorkflowOptions) (*core.Config, error) {
 	if opts.PipelineOptions.WerckerYml != "" {
 		werckerYaml, err = ioutil.ReadFile(opts.PipelineOptions.WerckerYml)
 	} else {
-		werckerYaml, err = core.ReadWerckerYaml([]string{"."}, false)
+		var yamlFile string
+		yamlFile, werckerYaml, err = core.ReadWerckerYaml([]string{"."}, false)
 		if err != nil {
 			return nil, err
 		}
-		opts.PipelineOptions.WerckerYml, _ = filepath.Abs("./wercker.yml")
+		opts.PipelineOptions.WerckerYml, _ = filepath.Abs(yamlFile)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	config, err := core.ConfigFromYaml(werckerYaml)
+	config, err := core.ConfigFromYamlFile(opts.PipelineOptions.WerckerYml, werckerYaml)
 	if err != nil {
 		return nil, err
 	}
@@ -83,14 +374,15 @@ func getConfig(opts *core.WorkflowOptions) (*core.Config, error) {
 }
 
 // nextPipeline returns the next pipeline to execute along with the list of IDs
-// of the pipeline's source runs. nil pipeline means end of the workflow.
+// of the pipeline's source runs. nil pipeline means no pipeline can start
+// until one of the started pipelines finishes, or the end of the workflow.
 //
 // One source runID means either sequential execution or fan-in with the source
 // artifact pipeline set. Multiple runIDs means fan-in with all source pipelines
 // acting as artifact sources.
-func nextPipeline(workflow *core.WorkflowConfig, pipelineRunMap map[string]string) (*core.WorkflowPipelineConfig, []string) {
+func nextPipeline(workflow *core.WorkflowConfig, pipelineRunMap map[string]string, started map[string]bool) (*core.WorkflowPipelineConfig, []string) {
 	for _, pipeline := range workflow.Pipelines {
-		if _, ok := pipelineRunMap[pipeline.Name]; ok {
+		if _, ok := pipelineRunMap[pipeline.Name]; ok || started[pipeline.Name] {
 			continue
 		}
 
@@ -136,14 +428,93 @@ func getPipelineOptions(opts *core.WorkflowOptions, pipeline *core.WorkflowPipel
 	po.RunID = bson.NewObjectId().Hex()
 	po.ShouldArtifacts = true
 
+	// Pipelines can run side by side, each gets its own project directory
+	// and creates its own docker network. They share the cache like the
+	// pipelines of a workflow always have.
+	po.Namespace = pipeline.Name
+	po.DockerNetworkName = ""
+
 	err := configureProjectPath(&po, pipeline.Name, sourceRunIDs, pipelineRunMap)
 	if err != nil {
 		return nil, err
 	}
 
+	err = configureOutputs(&po, pipeline, pipelineRunMap)
+	if err != nil {
+		return nil, err
+	}
+
 	return &po, nil
 }
 
+// configureOutputs passes the outputs of the pipelines that pipeline requires
+// on to it, an output NAME of pipeline build is WERCKER_OUTPUT_BUILD_NAME
+func configureOutputs(opts *core.PipelineOptions, pipeline *core.WorkflowPipelineConfig, pipelineRunMap map[string]string) error {
+	outputs := [][]string{}
+	for _, required := range pipeline.Requires {
+		runID, ok := pipelineRunMap[required]
+		if !ok {
+			continue
+		}
+		env, err := pipelineOutputs(opts, runID)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read the outputs of pipeline %s", required)
+		}
+		for _, pair := range env.Ordered() {
+			outputs = append(outputs, []string{outputEnvName(required, strings.TrimSpace(pair[0])), pair[1]})
+		}
+	}
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	// Every pipeline shares the HostEnv of the workflow, so the outputs go
+	// into a copy. They are passed through like the X_ variables of the host.
+	env := util.NewEnvironment()
+	if opts.HostEnv != nil {
+		env.Update(opts.HostEnv.Ordered())
+		if opts.HostEnv.Hidden != nil {
+			env.Hidden.Update(opts.HostEnv.Hidden.Ordered())
+		}
+	}
+	for _, pair := range outputs {
+		env.Add("X_"+pair[0], pair[1])
+	}
+	opts.HostEnv = env
+	return nil
+}
+
+// pipelineOutputs reads the outputs of the run runID, which are written to
+// WERCKER_OUTPUTS_FILE as NAME=value lines
+func pipelineOutputs(opts *core.PipelineOptions, runID string) (*util.Environment, error) {
+	env := util.NewEnvironment()
+	err := env.LoadFile(opts.BuildPath(runID, "outputs.env"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return env, nil
+}
+
+// outputEnvName returns the name of the env var holding the output name of
+// pipeline
+func outputEnvName(pipeline, name string) string {
+	return "WERCKER_OUTPUT_" + envNamePart(pipeline) + "_" + envNamePart(name)
+}
+
+// envNamePart uppercases s and replaces what is not allowed in an env var
+// name with underscores
+func envNamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
 func configureProjectPath(opts *core.PipelineOptions, name string, sourceRunIDs []string, pipelineStatus map[string]string) error {
 	if len(sourceRunIDs) == 1 {
 		latestPath, err := outputPath(opts, sourceRunIDs[0])
@@ -200,7 +571,7 @@ func outputPath(opts *core.PipelineOptions, runID string) (string, error) {
 func runPipeline(ctx context.Context, opts *core.PipelineOptions, dockerOptions *dockerlocal.Options) (string, error) {
 	_, err := cmdDeploy(ctx, opts, dockerOptions)
 	if err != nil {
-		return "", errors.Wrapf(err, "unable to run pipeline %s", opts.Pipeline)
+		return opts.RunID, errors.Wrapf(err, "unable to run pipeline %s", opts.Pipeline)
 	}
 
 	return opts.RunID, nil
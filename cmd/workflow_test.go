@@ -0,0 +1,416 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+type WorkflowSuite struct {
+	*util.TestSuite
+}
+
+func TestWorkflowSuite(t *testing.T) {
+	suiteTester := &WorkflowSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+// testWorkflow has build, then test and lint side by side, and deploy once
+// both passed
+func testWorkflow() *core.WorkflowConfig {
+	return &core.WorkflowConfig{
+		Name: "release",
+		Pipelines: []core.WorkflowPipelineConfig{
+			{Name: "build"},
+			{Name: "test", Requires: []string{"build"}},
+			{Name: "lint", Requires: []string{"build"}},
+			{Name: "deploy", Requires: []string{"test", "lint"}},
+		},
+	}
+}
+
+// newTestWorkflowState returns a state that is not saved
+func newTestWorkflowState() *workflowState {
+	return &workflowState{Pipelines: map[string]*workflowPipelineState{}}
+}
+
+func (s *WorkflowSuite) TestRunWorkflowParallel() {
+	var mutex sync.Mutex
+	ran := []string{}
+	// test and lint only finish once both of them started
+	both := &sync.WaitGroup{}
+	both.Add(2)
+
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		if pipeline.Name == "test" || pipeline.Name == "lint" {
+			s.Equal([]string{"build-run"}, sourceRunIDs)
+			both.Done()
+			both.Wait()
+		}
+		if pipeline.Name == "deploy" {
+			s.Len(sourceRunIDs, 2)
+		}
+		mutex.Lock()
+		ran = append(ran, pipeline.Name)
+		mutex.Unlock()
+		return pipeline.Name + "-run", nil
+	}
+
+	err := runWorkflow(context.Background(), testWorkflow(), newTestWorkflowState(), 2, false, run, nil)
+	s.Require().Nil(err)
+	s.Len(ran, 4)
+	s.Equal("build", ran[0])
+	s.Equal("deploy", ran[3])
+}
+
+func (s *WorkflowSuite) TestRunWorkflowMultipleRoots() {
+	// build and docs both start from the project, package needs both of them,
+	// and lint is not connected to the others at all
+	workflow := &core.WorkflowConfig{
+		Name: "release",
+		Pipelines: []core.WorkflowPipelineConfig{
+			{Name: "build"},
+			{Name: "docs"},
+			{Name: "package", Requires: []string{"build", "docs"}},
+			{Name: "lint"},
+		},
+	}
+	s.Equal([]string{"build", "docs", "lint"}, workflow.RootPipelines())
+
+	var mutex sync.Mutex
+	sources := map[string][]string{}
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		mutex.Lock()
+		sources[pipeline.Name] = sourceRunIDs
+		mutex.Unlock()
+		return pipeline.Name + "-run", nil
+	}
+
+	err := runWorkflow(context.Background(), workflow, newTestWorkflowState(), 0, false, run, nil)
+	s.Require().Nil(err)
+	s.Len(sources, 4)
+	s.Empty(sources["build"])
+	s.Empty(sources["docs"])
+	s.Empty(sources["lint"])
+	s.Equal([]string{"build-run", "docs-run"}, sources["package"])
+}
+
+func (s *WorkflowSuite) TestRunWorkflowMaxParallel() {
+	var mutex sync.Mutex
+	running, most := 0, 0
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		mutex.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return pipeline.Name + "-run", nil
+	}
+
+	err := runWorkflow(context.Background(), testWorkflow(), newTestWorkflowState(), 1, false, run, nil)
+	s.Require().Nil(err)
+	s.Equal(1, most)
+}
+
+func (s *WorkflowSuite) TestRunWorkflowFailure() {
+	for _, keepGoing := range []bool{false, true} {
+		var mutex sync.Mutex
+		ran := map[string]bool{}
+		run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+			mutex.Lock()
+			ran[pipeline.Name] = true
+			mutex.Unlock()
+			switch pipeline.Name {
+			case "test":
+				return "", fmt.Errorf("test failed")
+			case "lint":
+				// lint is cancelled when test fails, unless keepGoing is set
+				if !keepGoing {
+					<-ctx.Done()
+					return "", ctx.Err()
+				}
+			}
+			return pipeline.Name + "-run", nil
+		}
+
+		err := runWorkflow(context.Background(), testWorkflow(), newTestWorkflowState(), 0, keepGoing, run, nil)
+		s.Require().NotNil(err)
+		s.True(ran["lint"])
+		s.False(ran["deploy"])
+		s.Equal("test failed", err.Error())
+	}
+}
+
+func (s *WorkflowSuite) TestRunWorkflowResume() {
+	options := &core.PipelineOptions{WorkingDir: s.WorkingDir()}
+	state := newWorkflowState(options, "workflow-run", "release")
+
+	// The first run fails in deploy
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		runID := "first-" + pipeline.Name
+		if pipeline.Name == "deploy" {
+			return runID, fmt.Errorf("deploy failed")
+		}
+		s.Require().Nil(os.MkdirAll(options.BuildPath(runID, "output"), 0755))
+		return runID, nil
+	}
+	err := runWorkflow(context.Background(), testWorkflow(), state, 0, false, run, nil)
+	s.Require().NotNil(err)
+
+	state, err = loadWorkflowState(options, "workflow-run")
+	s.Require().Nil(err)
+	s.Equal("release", state.Workflow)
+	s.Equal("failed", state.Pipelines["deploy"].Result)
+	s.Equal(map[string]string{"build": "first-build", "test": "first-test", "lint": "first-lint"}, state.passed())
+
+	// Resuming only runs deploy, with the outputs of the first run
+	ran := []string{}
+	run = func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		ran = append(ran, pipeline.Name)
+		s.Equal("first-test", pipelineRunMap["test"])
+		return "second-" + pipeline.Name, nil
+	}
+	err = runWorkflow(context.Background(), testWorkflow(), state, 0, false, run, nil)
+	s.Require().Nil(err)
+	s.Equal([]string{"deploy"}, ran)
+
+	state, err = loadWorkflowState(options, "workflow-run")
+	s.Require().Nil(err)
+	s.Equal("passed", state.Pipelines["deploy"].Result)
+
+	// A run whose outputs are gone cannot be resumed
+	s.Require().Nil(os.RemoveAll(options.BuildPath("first-build")))
+	_, err = loadWorkflowState(options, "workflow-run")
+	s.Require().NotNil(err)
+
+	_, err = loadWorkflowState(options, "missing")
+	s.Require().NotNil(err)
+}
+
+func (s *WorkflowSuite) TestRunWorkflowApproval() {
+	options := &core.PipelineOptions{WorkingDir: s.WorkingDir()}
+	state := newWorkflowState(options, "workflow-run", "release")
+	workflow := testWorkflow()
+	workflow.Pipelines[3].Approval = true
+
+	var mutex sync.Mutex
+	ran := []string{}
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		mutex.Lock()
+		ran = append(ran, pipeline.Name)
+		mutex.Unlock()
+		return "", nil
+	}
+	asked := []string{}
+	stop := func(pipeline *core.WorkflowPipelineConfig) (bool, error) {
+		asked = append(asked, pipeline.Name)
+		return false, nil
+	}
+
+	// Without approval the workflow stops before deploy
+	err := runWorkflow(context.Background(), workflow, state, 0, false, run, stop)
+	s.Require().Nil(err)
+	s.Len(ran, 3)
+	s.Equal([]string{"deploy"}, asked)
+	s.Equal(map[string]bool{"deploy": true}, state.waiting())
+
+	// Resuming the run approves deploy without asking again
+	state, err = loadWorkflowState(options, "workflow-run")
+	s.Require().Nil(err)
+	ran = []string{}
+	err = runWorkflow(context.Background(), workflow, state, 0, false, run, stop)
+	s.Require().Nil(err)
+	s.Equal([]string{"deploy"}, ran)
+	s.Equal([]string{"deploy"}, asked)
+	s.Empty(state.waiting())
+	s.Equal("passed", state.Pipelines["deploy"].Result)
+}
+
+func (s *WorkflowSuite) TestRunWorkflowRejected() {
+	options := &core.PipelineOptions{WorkingDir: s.WorkingDir()}
+	state := newWorkflowState(options, "workflow-run", "release")
+	workflow := testWorkflow()
+	workflow.Pipelines[3].Approval = true
+
+	var mutex sync.Mutex
+	ran := []string{}
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		mutex.Lock()
+		ran = append(ran, pipeline.Name)
+		mutex.Unlock()
+		return "", nil
+	}
+	asked := 0
+	reject := func(pipeline *core.WorkflowPipelineConfig) (bool, error) {
+		asked++
+		return false, errPipelineRejected
+	}
+
+	err := runWorkflow(context.Background(), workflow, state, 0, false, run, reject)
+	s.Require().Nil(err)
+	s.Len(ran, 3)
+	s.Equal("rejected", state.Pipelines["deploy"].Result)
+	s.Empty(state.waiting())
+
+	// Resuming the run asks again instead of running deploy
+	state, err = loadWorkflowState(options, "workflow-run")
+	s.Require().Nil(err)
+	ran = []string{}
+	err = runWorkflow(context.Background(), workflow, state, 0, false, run, reject)
+	s.Require().Nil(err)
+	s.Empty(ran)
+	s.Equal(2, asked)
+}
+
+func (s *WorkflowSuite) TestWorkflowApproval() {
+	pipeline := &core.WorkflowPipelineConfig{Name: "deploy", Approval: true}
+
+	approved, err := workflowApproval(&core.WorkflowOptions{AutoApprove: true})(pipeline)
+	s.Nil(err)
+	s.True(approved)
+
+	approved, err = workflowApproval(&core.WorkflowOptions{StopAtApproval: true})(pipeline)
+	s.Nil(err)
+	s.False(approved)
+}
+
+func (s *WorkflowSuite) TestConfigureOutputs() {
+	options := &core.PipelineOptions{
+		WorkingDir: s.WorkingDir(),
+		HostEnv:    util.NewEnvironment("X_FOO=bar"),
+	}
+	s.Require().Nil(os.MkdirAll(options.BuildPath("build-run"), 0755))
+	outputs := "# the image that was built\nIMAGE_TAG=v1.2.3\nmy-version = \"1.2\"\n"
+	s.Require().Nil(ioutil.WriteFile(options.BuildPath("build-run", "outputs.env"), []byte(outputs), 0644))
+
+	pipelineRunMap := map[string]string{"build": "build-run", "lint": "lint-run"}
+	pipeline := &core.WorkflowPipelineConfig{Name: "deploy", Requires: []string{"build", "lint"}}
+
+	opts := *options
+	s.Require().Nil(configureOutputs(&opts, pipeline, pipelineRunMap))
+	passthru := opts.HostEnv.GetPassthru()
+	s.Equal("v1.2.3", passthru.Get("WERCKER_OUTPUT_BUILD_IMAGE_TAG"))
+	s.Equal("1.2", passthru.Get("WERCKER_OUTPUT_BUILD_MY_VERSION"))
+	s.Equal("bar", passthru.Get("FOO"))
+
+	// The HostEnv of the workflow is left alone
+	s.Equal("", options.HostEnv.Get("X_WERCKER_OUTPUT_BUILD_IMAGE_TAG"))
+
+	// Pipelines without outputs pass nothing on
+	opts = *options
+	pipeline = &core.WorkflowPipelineConfig{Name: "test", Requires: []string{"lint"}}
+	s.Require().Nil(configureOutputs(&opts, pipeline, pipelineRunMap))
+	s.True(opts.HostEnv == options.HostEnv)
+}
+
+func (s *WorkflowSuite) TestSkippedPipelines() {
+	workflow := testWorkflow()
+	workflow.Pipelines[1].Filters = &core.WorkflowFiltersConfig{Paths: []string{"src/"}}
+	workflow.Pipelines[2].Filters = &core.WorkflowFiltersConfig{Branches: []string{"master"}}
+
+	s.Equal(map[string]string{}, skippedPipelines(workflow, "master", []string{"src/main.go"}))
+	s.Equal(map[string]string{}, skippedPipelines(workflow, "master", nil))
+
+	skipped := skippedPipelines(workflow, "feature", []string{"README.md"})
+	s.Equal("no files matching its filters changed", skipped["test"])
+	s.Equal("branch feature does not match its filters", skipped["lint"])
+	s.Equal("it requires skipped pipeline test", skipped["deploy"])
+	s.Len(skipped, 3)
+}
+
+func (s *WorkflowSuite) TestRunWorkflowSkipped() {
+	workflow := testWorkflow()
+	state := newTestWorkflowState()
+	s.Require().Nil(state.skip(map[string]string{"lint": "", "deploy": ""}))
+
+	ran := []string{}
+	run := func(ctx context.Context, pipeline *core.WorkflowPipelineConfig, sourceRunIDs []string, pipelineRunMap map[string]string) (string, error) {
+		ran = append(ran, pipeline.Name)
+		return pipeline.Name + "-run", nil
+	}
+	err := runWorkflow(context.Background(), workflow, state, 1, false, run, nil)
+	s.Require().Nil(err)
+	s.Equal([]string{"build", "test"}, ran)
+	s.Equal("skipped", state.Pipelines["deploy"].Result)
+
+	// Skipping again replaces what was skipped before
+	s.Require().Nil(state.skip(map[string]string{"build": ""}))
+	s.Equal(map[string]bool{}, state.skipped())
+	s.Equal("passed", state.Pipelines["build"].Result)
+}
+
+func (s *WorkflowSuite) TestChangedFiles() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.Skip("git is not installed")
+	}
+	dir := s.WorkingDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		s.Require().Nil(err, string(out))
+	}
+	write := func(name string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		s.Require().Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().Nil(ioutil.WriteFile(path, []byte(name), 0644))
+	}
+
+	git("init", "-q")
+	write("README.md")
+	git("add", ".")
+	git("commit", "-q", "-m", "first")
+	git("tag", "base")
+	write("src/main.go")
+	git("add", ".")
+	git("commit", "-q", "-m", "second")
+	write("docs/new.md")
+
+	changed, err := changedFiles(dir, "")
+	s.Require().Nil(err)
+	s.Equal([]string{"docs/new.md"}, changed)
+
+	changed, err = changedFiles(dir, "base")
+	s.Require().Nil(err)
+	s.Equal([]string{"docs/new.md", "src/main.go"}, changed)
+
+	_, err = changedFiles(dir, "missing")
+	s.NotNil(err)
+}
+
+func (s *WorkflowSuite) TestWorkflowPipelinesShareCache() {
+	opts := &core.PipelineOptions{WorkingDir: "/tmp/wercker", Namespace: "test"}
+	s.Equal("/tmp/wercker/cache", opts.CachePath())
+
+	opts.SeparateCache = true
+	s.Equal("/tmp/wercker/cache/test", opts.CachePath())
+}
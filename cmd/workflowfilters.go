@@ -0,0 +1,113 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/wercker/core"
+)
+
+// hasPathFilters is true when a pipeline of workflow has path filters, only
+// then the changed files are needed
+func hasPathFilters(workflow *core.WorkflowConfig) bool {
+	for _, pipeline := range workflow.Pipelines {
+		if pipeline.Filters != nil && len(pipeline.Filters.Paths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFiles returns the files of the git repository in dir that changed
+// since baseRef, plus the uncommitted and untracked ones. Only the latter
+// count when baseRef is empty.
+func changedFiles(dir, baseRef string) ([]string, error) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		return nil, err
+	}
+
+	commands := [][]string{
+		{"diff", "--name-only", "HEAD"},
+		{"ls-files", "--others", "--exclude-standard"},
+	}
+	if baseRef != "" {
+		commands = append(commands, []string{"diff", "--name-only", baseRef + "...HEAD"})
+	}
+
+	files := map[string]bool{}
+	for _, args := range commands {
+		var out, stderr bytes.Buffer
+		cmd := exec.Command(git, args...)
+		cmd.Dir = dir
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, errors.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+		}
+		for _, file := range strings.Split(out.String(), "\n") {
+			if file != "" {
+				files[file] = true
+			}
+		}
+	}
+
+	changed := []string{}
+	for file := range files {
+		changed = append(changed, file)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// skippedPipelines returns the pipelines of workflow that are skipped, with
+// the reason, because their filters do not match branch or the changed
+// files, or because they require a skipped pipeline. changed is nil when the
+// changed files are not known.
+func skippedPipelines(workflow *core.WorkflowConfig, branch string, changed []string) map[string]string {
+	skipped := map[string]string{}
+	for _, pipeline := range workflow.Pipelines {
+		if !pipeline.Filters.MatchesBranch(branch) {
+			skipped[pipeline.Name] = fmt.Sprintf("branch %s does not match its filters", branch)
+		} else if !pipeline.Filters.MatchesPaths(changed) {
+			skipped[pipeline.Name] = "no files matching its filters changed"
+		}
+	}
+
+	// The pipelines can be in any order, keep going until no more pipelines
+	// get skipped because of the pipelines they require
+	for found := true; found; {
+		found = false
+		for _, pipeline := range workflow.Pipelines {
+			if _, ok := skipped[pipeline.Name]; ok {
+				continue
+			}
+			for _, required := range pipeline.Requires {
+				if _, ok := skipped[required]; ok {
+					skipped[pipeline.Name] = fmt.Sprintf("it requires skipped pipeline %s", required)
+					found = true
+					break
+				}
+			}
+		}
+	}
+	return skipped
+}
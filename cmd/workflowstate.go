@@ -0,0 +1,177 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+// workflowState is what a local workflow run has done so far. It is saved
+// under the working dir after every pipeline, so a failed run can be resumed
+// from the pipelines that did not pass.
+type workflowState struct {
+	ID        string                            `json:"id"`
+	Workflow  string                            `json:"workflow"`
+	Pipelines map[string]*workflowPipelineState `json:"pipelines"`
+
+	// path is where the state is saved, nothing is saved when it is empty
+	path    string
+	options *core.PipelineOptions
+}
+
+// workflowPipelineState is the last run of a pipeline of a workflow
+type workflowPipelineState struct {
+	RunID      string `json:"runId"`
+	Result     string `json:"result"`
+	OutputPath string `json:"outputPath,omitempty"`
+}
+
+// workflowStatePath returns where the state of the workflow run id is saved
+func workflowStatePath(options *core.PipelineOptions, id string) string {
+	return options.WorkingPath("workflows", id, "state.json")
+}
+
+func newWorkflowState(options *core.PipelineOptions, id, workflow string) *workflowState {
+	return &workflowState{
+		ID:        id,
+		Workflow:  workflow,
+		Pipelines: map[string]*workflowPipelineState{},
+		path:      workflowStatePath(options, id),
+		options:   options,
+	}
+}
+
+// loadWorkflowState reads the state of the workflow run id, making sure the
+// output of every pipeline that passed is still there
+func loadWorkflowState(options *core.PipelineOptions, id string) (*workflowState, error) {
+	path := workflowStatePath(options, id)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("no workflow run %s in %s", id, options.WorkingDir)
+		}
+		return nil, err
+	}
+
+	state := &workflowState{path: path, options: options}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, errors.Wrapf(err, "unable to read the state of workflow run %s", id)
+	}
+	if state.Pipelines == nil {
+		state.Pipelines = map[string]*workflowPipelineState{}
+	}
+
+	for name, pipeline := range state.Pipelines {
+		if pipeline.Result != "passed" || pipeline.OutputPath == "" {
+			continue
+		}
+		found, err := util.Exists(pipeline.OutputPath)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.Errorf("the output of pipeline %s (run %s) is gone, workflow run %s cannot be resumed", name, pipeline.RunID, id)
+		}
+	}
+	return state, nil
+}
+
+// passed returns the RunIDs of the pipelines that passed, by pipeline name
+func (s *workflowState) passed() map[string]string {
+	pipelineRunMap := map[string]string{}
+	for name, pipeline := range s.Pipelines {
+		if pipeline.Result == "passed" {
+			pipelineRunMap[name] = pipeline.RunID
+		}
+	}
+	return pipelineRunMap
+}
+
+// waiting returns the names of the pipelines that are waiting for approval,
+// rejected pipelines are not waiting
+func (s *workflowState) waiting() map[string]bool {
+	waiting := map[string]bool{}
+	for name, pipeline := range s.Pipelines {
+		if pipeline.Result == "waiting" {
+			waiting[name] = true
+		}
+	}
+	return waiting
+}
+
+// skipped returns the names of the pipelines that are skipped
+func (s *workflowState) skipped() map[string]bool {
+	skipped := map[string]bool{}
+	for name, pipeline := range s.Pipelines {
+		if pipeline.Result == "skipped" {
+			skipped[name] = true
+		}
+	}
+	return skipped
+}
+
+// skip marks the pipelines in skipped as skipped, instead of the ones an
+// earlier run of the workflow skipped, and saves the state. Pipelines that
+// passed already keep their result.
+func (s *workflowState) skip(skipped map[string]string) error {
+	for name := range s.skipped() {
+		delete(s.Pipelines, name)
+	}
+	for name := range skipped {
+		if pipeline, ok := s.Pipelines[name]; ok && pipeline.Result == "passed" {
+			continue
+		}
+		s.Pipelines[name] = &workflowPipelineState{Result: "skipped"}
+	}
+	return s.save()
+}
+
+// record stores the result of a pipeline and saves the state
+func (s *workflowState) record(result *workflowRun) error {
+	pipeline := &workflowPipelineState{RunID: result.runID, Result: "passed"}
+	if result.waiting {
+		pipeline.Result = "waiting"
+	} else if result.rejected {
+		pipeline.Result = "rejected"
+	} else if result.err != nil {
+		pipeline.Result = "failed"
+	} else if s.options != nil {
+		// Not every pipeline has an output
+		pipeline.OutputPath, _ = outputPath(s.options, result.runID)
+	}
+	s.Pipelines[result.pipeline.Name] = pipeline
+	return s.save()
+}
+
+func (s *workflowState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, b, 0644)
+}
@@ -0,0 +1,293 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/wercker/wercker/util"
+)
+
+// conditionAliases are friendlier names for commonly used variables in
+// `when` conditions
+var conditionAliases = map[string]string{
+	"branch": "WERCKER_GIT_BRANCH",
+	"result": "WERCKER_RESULT",
+}
+
+// Condition is a parsed `when` expression. The syntax is deliberately small:
+//
+//	branch == "master"
+//	WERCKER_RESULT == "failed"
+//	$DEPLOY_TOKEN && branch != "develop"
+//	!(result == "passed" || $FORCE)
+//
+// A variable on its own is true when it is set to a non-empty value. Values
+// are looked up in the pipeline environment, `branch` and `result` are
+// aliases for WERCKER_GIT_BRANCH and WERCKER_RESULT.
+type Condition struct {
+	expr string
+	root conditionNode
+}
+
+// ParseCondition parses expr so it can be evaluated later on.
+func ParseCondition(expr string) (*Condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid condition %q", expr)
+	}
+	p := &conditionParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid condition %q", expr)
+	}
+	return &Condition{expr: expr, root: root}, nil
+}
+
+// EvaluateCondition parses and evaluates expr against env.
+func EvaluateCondition(expr string, env *util.Environment) (bool, error) {
+	c, err := ParseCondition(expr)
+	if err != nil {
+		return false, err
+	}
+	return c.Evaluate(env), nil
+}
+
+// Evaluate the condition against env.
+func (c *Condition) Evaluate(env *util.Environment) bool {
+	return c.root.truthy(env)
+}
+
+// String returns the original expression
+func (c *Condition) String() string {
+	return c.expr
+}
+
+type conditionNode interface {
+	truthy(env *util.Environment) bool
+	value(env *util.Environment) string
+}
+
+type literalNode string
+
+func (n literalNode) truthy(env *util.Environment) bool  { return string(n) != "" }
+func (n literalNode) value(env *util.Environment) string { return string(n) }
+
+type boolNode bool
+
+func (n boolNode) truthy(env *util.Environment) bool  { return bool(n) }
+func (n boolNode) value(env *util.Environment) string { return fmt.Sprint(bool(n)) }
+
+type variableNode string
+
+func (n variableNode) truthy(env *util.Environment) bool { return n.value(env) != "" }
+func (n variableNode) value(env *util.Environment) string {
+	name := string(n)
+	if alias, ok := conditionAliases[name]; ok {
+		name = alias
+	}
+	return env.Get(name)
+}
+
+type notNode struct {
+	node conditionNode
+}
+
+func (n *notNode) truthy(env *util.Environment) bool  { return !n.node.truthy(env) }
+func (n *notNode) value(env *util.Environment) string { return fmt.Sprint(n.truthy(env)) }
+
+type binaryNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (n *binaryNode) truthy(env *util.Environment) bool {
+	switch n.op {
+	case "==":
+		return n.left.value(env) == n.right.value(env)
+	case "!=":
+		return n.left.value(env) != n.right.value(env)
+	case "&&":
+		return n.left.truthy(env) && n.right.truthy(env)
+	default:
+		return n.left.truthy(env) || n.right.truthy(env)
+	}
+}
+
+func (n *binaryNode) value(env *util.Environment) string { return fmt.Sprint(n.truthy(env)) }
+
+type conditionToken struct {
+	kind string // "op", "string" or "ident"
+	text string
+}
+
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	tokens := []conditionToken{}
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, conditionToken{"op", string(r)})
+			i++
+		case r == '!' && (i+1 >= len(runes) || runes[i+1] != '='):
+			tokens = append(tokens, conditionToken{"op", "!"})
+			i++
+		case i+1 < len(runes) && isConditionOperator(string(runes[i:i+2])):
+			tokens = append(tokens, conditionToken{"op", string(runes[i : i+2])})
+			i += 2
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, conditionToken{"string", string(runes[i+1 : end])})
+			i = end + 1
+		case r == '$' || r == '_' || unicode.IsLetter(r):
+			start := i
+			if r == '$' {
+				start++
+			}
+			end := start
+			for end < len(runes) && (runes[end] == '_' || unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			if end == start {
+				return nil, fmt.Errorf("expected a variable name after $")
+			}
+			tokens = append(tokens, conditionToken{"ident", string(runes[start:end])})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+func isConditionOperator(s string) bool {
+	return s == "==" || s == "!=" || s == "&&" || s == "||"
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) peek(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == "op" && p.tokens[p.pos].text == op
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("&&") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	if p.peek("!") {
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node: node}, nil
+	}
+	if p.peek("(") {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek("==") || p.peek("!=") {
+		op := p.tokens[p.pos].text
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseOperand() (conditionNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of condition")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case "string":
+		return literalNode(token.text), nil
+	case "ident":
+		switch strings.ToLower(token.text) {
+		case "true":
+			return boolNode(true), nil
+		case "false":
+			return boolNode(false), nil
+		}
+		return variableNode(token.text), nil
+	default:
+		return nil, fmt.Errorf("unexpected %s", token.text)
+	}
+}
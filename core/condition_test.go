@@ -0,0 +1,83 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type ConditionSuite struct {
+	*util.TestSuite
+}
+
+func TestConditionSuite(t *testing.T) {
+	suiteTester := &ConditionSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *ConditionSuite) TestEvaluateCondition() {
+	env := util.NewEnvironment(
+		"WERCKER_GIT_BRANCH=master",
+		"WERCKER_RESULT=failed",
+		"DEPLOY_TOKEN=secret",
+		"EMPTY=",
+	)
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`branch == "master"`, true},
+		{`branch == 'develop'`, false},
+		{`branch != "develop"`, true},
+		{`WERCKER_RESULT == "failed"`, true},
+		{`result == "passed"`, false},
+		{`$DEPLOY_TOKEN`, true},
+		{`DEPLOY_TOKEN`, true},
+		{`$EMPTY`, false},
+		{`$MISSING`, false},
+		{`!$MISSING`, true},
+		{`$DEPLOY_TOKEN && branch == "master"`, true},
+		{`$MISSING || branch == "master"`, true},
+		{`!(result == "failed" || $MISSING)`, false},
+		{`true`, true},
+		{`false`, false},
+	}
+
+	for _, test := range tests {
+		actual, err := EvaluateCondition(test.expr, env)
+		s.Nil(err, test.expr)
+		s.Equal(test.expected, actual, test.expr)
+	}
+}
+
+func (s *ConditionSuite) TestParseConditionErrors() {
+	tests := []string{
+		`branch ==`,
+		`branch == "master`,
+		`(branch == "master"`,
+		`branch = "master"`,
+		`$`,
+		`branch "master"`,
+	}
+
+	for _, expr := range tests {
+		_, err := ParseCondition(expr)
+		s.NotNil(err, expr)
+	}
+}
@@ -15,8 +15,10 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"path"
 	"strconv"
 	"strings"
@@ -70,6 +72,27 @@ func (r *RawBoxConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// EnvConfig holds the environment variables from an env section of the
+// wercker.yml, in the order they were defined
+type EnvConfig [][]string
+
+// UnmarshalYAML reads a map of variables, keeping the order
+func (e *EnvConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var m yamlMapSlice
+	err := unmarshal(&m)
+	if err != nil {
+		return err
+	}
+	for _, item := range m {
+		value, err := item.Value.toString()
+		if err != nil {
+			return fmt.Errorf("Environment variable %s has an unsupported value: %s", item.Key, err.Error())
+		}
+		*e = append(*e, []string{item.Key, value})
+	}
+	return nil
+}
+
 // RawStepConfig is our unwrapper for config steps
 type RawStepConfig struct {
 	*StepConfig
@@ -82,26 +105,189 @@ type StepConfig struct {
 	Name       string
 	Data       map[string]string
 	Checkpoint string
+	When       string
+	// Timeout and NoResponseTimeout override the command-timeout and
+	// no-response-timeout for this step, in minutes
+	Timeout           int
+	NoResponseTimeout int
+	// Retry is set when the step should be run again if it fails
+	Retry *RetryConfig
+	// AllowFailure steps only add a warning to the pipeline when they fail
+	AllowFailure bool
+	// Parallel holds the steps of a parallel group, they run at the same
+	// time and the group fails if any of them fails
+	Parallel RawStepsConfig
+	// RawData holds the step properties with their yaml types, lists and
+	// maps are kept as []interface{} and map[string]interface{}
+	RawData map[string]interface{}
+}
+
+// yamlValue is a value read from the yaml that keeps its scalars as they
+// were written, yaml would read `1.10` as the float 1.1 otherwise
+type yamlValue struct {
+	// value is the value as yaml reads it
+	value interface{}
+	// text is a scalar as it was written
+	text string
+	// items are the values of a list, entries the ones of a map
+	items   []*yamlValue
+	entries yamlMapSlice
+}
+
+// UnmarshalYAML reads the value, yaml keeps the text of a scalar when it is
+// read into a string
+func (v *yamlValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&v.value); err != nil {
+		return err
+	}
+	switch v.value.(type) {
+	case []interface{}:
+		v.items = []*yamlValue{}
+		return unmarshal(&v.items)
+	case map[interface{}]interface{}:
+		return unmarshal(&v.entries)
+	}
+	return unmarshal(&v.text)
+}
+
+// toString makes the value a string so it can be passed to a step as an
+// environment variable:
+//
+//	scalars are kept as they were written
+//	null becomes an empty string
+//	lists of scalars are joined with newlines
+//	maps and nested lists are encoded as JSON
+//
+// An error is returned for values that cannot be represented.
+func (v *yamlValue) toString() (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	switch value := v.value.(type) {
+	case []interface{}:
+		lines := []string{}
+		for _, item := range v.items {
+			if item != nil {
+				switch item.value.(type) {
+				case []interface{}, map[interface{}]interface{}:
+					return yamlToJSON(value)
+				}
+			}
+			line, err := item.toString()
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), nil
+	case map[interface{}]interface{}:
+		return yamlToJSON(value)
+	default:
+		if _, err := yamlToPlain(value); err != nil {
+			return "", err
+		}
+		return v.text, nil
+	}
+}
+
+// plain returns the value with the types encoding/json understands
+func (v *yamlValue) plain() interface{} {
+	if v == nil {
+		return nil
+	}
+	plain, _ := yamlToPlain(v.value)
+	return plain
 }
 
-// ifaceToString takes a value from yaml and makes it a string (currently
-// supported: string, int, bool). Returns an empty string if the type is not
-// supported.
-func ifaceToString(dataValue interface{}) string {
+// yamlMapSlice is a yaml map in the order it was written, with its values
+// read as yamlValues
+type yamlMapSlice []yamlMapItem
+
+// yamlMapItem is an item of a yamlMapSlice
+type yamlMapItem struct {
+	Key   string
+	Value *yamlValue
+}
+
+// UnmarshalYAML reads the order of the keys and their values separately
+func (m *yamlMapSlice) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var keys yaml.MapSlice
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	values := map[string]*yamlValue{}
+	if err := unmarshal(&values); err != nil {
+		return err
+	}
+	for _, item := range keys {
+		*m = append(*m, yamlMapItem{Key: item.Key, Value: values[item.Key]})
+	}
+	return nil
+}
+
+func formatYamlFloat(f float64) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("%v can not be represented", f)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+func yamlToJSON(dataValue interface{}) (string, error) {
+	value, err := yamlToPlain(dataValue)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// yamlToPlain converts the generic yaml representation of a value to the
+// types encoding/json understands
+func yamlToPlain(dataValue interface{}) (interface{}, error) {
 	switch v := dataValue.(type) {
-	case string:
-		return v
-	case int:
-		return strconv.Itoa(v)
-	case int32:
-		i := int64(v)
-		return strconv.FormatInt(i, 10)
-	case int64:
-		return strconv.FormatInt(v, 10)
-	case bool:
-		return strconv.FormatBool(v)
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			value, err := yamlToPlain(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(item.Key)] = value
+		}
+		return m, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := yamlToPlain(item)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(key)] = value
+		}
+		return m, nil
+	case []interface{}:
+		l := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			value, err := yamlToPlain(item)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, value)
+		}
+		return l, nil
+	case float32:
+		_, err := formatYamlFloat(float64(v))
+		return v, err
+	case float64:
+		_, err := formatYamlFloat(v)
+		return v, err
+	case nil, string, bool, int, int32, int64, uint64:
+		return v, nil
 	default:
-		return ("")
+		return nil, fmt.Errorf("values of type %T are not supported", dataValue)
 	}
 }
 
@@ -126,29 +312,46 @@ func (r *RawStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 
 	// Next check whether we are a one-key map
 	var stepID string
-	stepData := make(map[string]string)
+	var dataItems yamlMapSlice
 	var topMap yaml.MapSlice
 	err = unmarshal(&topMap)
 	if len(topMap) == 1 {
 		// The only item's key will be the stepID, value is data
 		item := topMap[0]
 		stepID = item.Key
-		interData, ok := item.Value.(yaml.MapSlice)
-		if !ok {
+		if stepID == "parallel" {
+			return r.unmarshalParallel(unmarshal)
+		}
+		if _, ok := item.Value.(yaml.MapSlice); !ok {
 			return fmt.Errorf("Step %s is empty", item.Key)
 		}
-		for _, item := range interData {
-			stepData[item.Key] = ifaceToString(item.Value)
+		var data map[string]yamlMapSlice
+		if err := unmarshal(&data); err != nil {
+			return err
 		}
+		dataItems = data[stepID]
 	} else {
 		// Otherwise the first element's key is the id, and the rest
 		// of the elements are the data
 		// TODO(termie): Throw a deprecation/bad usage warning
 		firstItem := topMap[0]
 		stepID = firstItem.Key
-		for _, item := range topMap[1:] {
-			stepData[item.Key] = ifaceToString(item.Value)
+		var items yamlMapSlice
+		if err := unmarshal(&items); err != nil {
+			return err
 		}
+		dataItems = items[1:]
+	}
+
+	stepData := make(map[string]string)
+	rawData := make(map[string]interface{})
+	for _, item := range dataItems {
+		value, err := item.Value.toString()
+		if err != nil {
+			return fmt.Errorf("Step %s has an unsupported value for %s: %s", stepID, item.Key, err.Error())
+		}
+		stepData[item.Key] = value
+		rawData[item.Key] = item.Value.plain()
 	}
 
 	r.ID = stepID
@@ -157,22 +360,118 @@ func (r *RawStepConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if v, ok := stepData["cwd"]; ok {
 		r.Cwd = v
 		delete(stepData, "cwd")
+		delete(rawData, "cwd")
 	}
 	if v, ok := stepData["name"]; ok {
 		r.Name = v
 		delete(stepData, "name")
+		delete(rawData, "name")
 	}
 	if v, ok := stepData["checkpoint"]; ok {
 		r.Checkpoint = v
 		delete(stepData, "checkpoint")
+		delete(rawData, "checkpoint")
+	}
+	if v, ok := stepData["when"]; ok {
+		if _, err := ParseCondition(v); err != nil {
+			return fmt.Errorf("Step %s has an %s", stepID, err.Error())
+		}
+		r.When = v
+		delete(stepData, "when")
+		delete(rawData, "when")
+	}
+	if v, ok := stepData["timeout"]; ok {
+		if r.Timeout, err = parseStepMinutes(stepID, "timeout", v); err != nil {
+			return err
+		}
+		delete(stepData, "timeout")
+		delete(rawData, "timeout")
+	}
+	if v, ok := stepData["no-response-timeout"]; ok {
+		if r.NoResponseTimeout, err = parseStepMinutes(stepID, "no-response-timeout", v); err != nil {
+			return err
+		}
+		delete(stepData, "no-response-timeout")
+		delete(rawData, "no-response-timeout")
+	}
+	if v, ok := rawData["retry"]; ok {
+		if r.Retry, err = parseRetryConfig(stepID, v); err != nil {
+			return err
+		}
+		delete(stepData, "retry")
+		delete(rawData, "retry")
+	}
+	for _, key := range []string{"allow-failure", "continue-on-error"} {
+		if v, ok := stepData[key]; ok {
+			allow, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("Step %s has an invalid %s %q, expected true or false", stepID, key, v)
+			}
+			r.AllowFailure = r.AllowFailure || allow
+			delete(stepData, key)
+			delete(rawData, key)
+		}
 	}
 	r.Data = stepData
+	r.RawData = rawData
 	return nil
 }
 
+// unmarshalParallel reads a parallel group, a list of steps under the
+// parallel key:
+//
+//    - parallel:
+//        - script:
+//            code: make lint
+//        - script:
+//            code: make test
+func (r *RawStepConfig) unmarshalParallel(unmarshal func(interface{}) error) error {
+	var group struct {
+		Steps RawStepsConfig `yaml:"parallel"`
+	}
+	if err := unmarshal(&group); err != nil {
+		return err
+	}
+	if len(group.Steps) == 0 {
+		return fmt.Errorf("Step parallel has no steps")
+	}
+	for _, step := range group.Steps {
+		if step.ID == "parallel" {
+			return fmt.Errorf("Step parallel can not contain another parallel group")
+		}
+	}
+	r.ID = "parallel"
+	r.Data = make(map[string]string)
+	r.RawData = make(map[string]interface{})
+	r.Parallel = group.Steps
+	return nil
+}
+
+// parseStepMinutes parses a step property that holds a number of minutes
+func parseStepMinutes(stepID, key, value string) (int, error) {
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes <= 0 {
+		return 0, fmt.Errorf("Step %s has an invalid %s %q, expected a number of minutes", stepID, key, value)
+	}
+	return minutes, nil
+}
+
 // RawStepsConfig is a list of RawStepConfigs
 type RawStepsConfig []*RawStepConfig
 
+// targetStepsConfig reads the steps of a deploy target, any other section of
+// the pipeline fails to read as a list of steps
+type targetStepsConfig struct {
+	steps []*RawStepConfig
+	err   error
+}
+
+// UnmarshalYAML keeps the error, it only matters for the deploy targets
+func (t *targetStepsConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	t.err = unmarshal(&t.steps)
+	return nil
+}
+
 // RawPipelineConfig is our unwrapper for PipelineConfig
 type RawPipelineConfig struct {
 	*PipelineConfig
@@ -187,9 +486,29 @@ type PipelineConfig struct {
 	Steps      RawStepsConfig
 	AfterSteps RawStepsConfig `yaml:"after-steps"`
 	StepsMap   map[string][]*RawStepConfig
-	Services   []*RawBoxConfig `yaml:"services"`
-	BasePath   string          `yaml:"base-path"`
-	Docker     bool            `yaml:"docker"`
+	Services   []*RawBoxConfig   `yaml:"services"`
+	BasePath   string            `yaml:"base-path"`
+	Docker     bool              `yaml:"docker"`
+	Extends    string            `yaml:"extends"`
+	Merge      map[string]string `yaml:"merge"`
+	Matrix     *MatrixConfig     `yaml:"matrix"`
+	Env        EnvConfig         `yaml:"env"`
+	Timeout    int               `yaml:"timeout"`
+
+	// OnSuccess and OnFailure run after the after-steps depending on the
+	// result of the steps, Always runs after either of them
+	OnSuccess RawStepsConfig `yaml:"on-success"`
+	OnFailure RawStepsConfig `yaml:"on-failure"`
+	Always    RawStepsConfig `yaml:"always"`
+
+	// Set by Config.ExpandMatrices, MatrixPipelines lists the expansions of
+	// a pipeline with a matrix and MatrixParent and MatrixExpansion describe
+	// where an expanded pipeline came from.
+	MatrixPipelines []string         `yaml:"-"`
+	MatrixParent    string           `yaml:"-"`
+	MatrixExpansion *MatrixExpansion `yaml:"-"`
+
+	extendsResolved bool
 }
 
 var pipelineReservedWords = map[string]struct{}{
@@ -197,8 +516,16 @@ var pipelineReservedWords = map[string]struct{}{
 	"services":    struct{}{},
 	"steps":       struct{}{},
 	"after-steps": struct{}{},
+	"on-success":  struct{}{},
+	"on-failure":  struct{}{},
+	"always":      struct{}{},
 	"base-path":   struct{}{},
 	"docker":      struct{}{},
+	"extends":     struct{}{},
+	"merge":       struct{}{},
+	"matrix":      struct{}{},
+	"env":         struct{}{},
+	"timeout":     struct{}{},
 }
 
 // UnmarshalYAML in this case is a little involved due to the myriad shapes our
@@ -215,7 +542,7 @@ func (r *RawPipelineConfig) UnmarshalYAML(unmarshal func(interface{}) error) err
 	}
 
 	// Then treat it like a map to get the extra fields
-	m := map[string]interface{}{}
+	m := map[string]*targetStepsConfig{}
 	err = unmarshal(&m)
 	if err != nil {
 		return err
@@ -225,20 +552,14 @@ func (r *RawPipelineConfig) UnmarshalYAML(unmarshal func(interface{}) error) err
 		if _, ok := pipelineReservedWords[k]; ok {
 			continue
 		}
-
-		// Marshal the data so we can use the unmarshal logic on it
-		b, err := yaml.Marshal(v)
-		if err != nil {
-			return err
+		if v == nil {
+			r.PipelineConfig.StepsMap[k] = nil
+			continue
 		}
-
-		// Finally, unmarshal each section as steps and add it to our map
-		var otherSteps []*RawStepConfig
-		err = yaml.Unmarshal(b, &otherSteps)
-		if err != nil {
+		if v.err != nil {
 			return &yaml.TypeError{Errors: []string{fmt.Sprintf("Invalid extra key in pipeline, %s is not a list of steps", k)}}
 		}
-		r.PipelineConfig.StepsMap[k] = otherSteps
+		r.PipelineConfig.StepsMap[k] = v.steps
 	}
 
 	// Having a slash in the path will cause sources to end up in /pipeline/source/source.
@@ -254,6 +575,13 @@ type WorkflowPipelineConfig struct {
 	PipelineName     string   `yaml:"pipelineName"`
 	Requires         []string `yaml:"requires"`
 	ArtifactPipeline string   `yaml:"artifactPipeline"`
+	// Approval makes a local workflow ask before it runs the pipeline,
+	// showing ApprovalMessage if it is set
+	Approval        bool   `yaml:"approval"`
+	ApprovalMessage string `yaml:"approvalMessage"`
+	// Filters skip the pipeline, and the pipelines that require it, unless
+	// the branch or the changed files match
+	Filters *WorkflowFiltersConfig `yaml:"filters"`
 }
 
 // GetYAMLPipelineName returns name of the pipeline to run.
@@ -303,68 +631,92 @@ func (workflow *WorkflowConfig) Validate(config *Config) error {
 		}
 	}
 
-	// check that there is only one root pipeline
-	rootPipelines := []string{}
+	// check that the filters can be matched
 	for _, pipeline := range workflow.Pipelines {
-		if len(pipeline.Requires) == 0 {
-			rootPipelines = append(rootPipelines, pipeline.Name)
+		if pipeline.Filters == nil {
+			continue
+		}
+		if err := pipeline.Filters.Validate(); err != nil {
+			return errors.Wrapf(err, "pipeline %s", pipeline.Name)
 		}
-	}
-	switch {
-	case len(rootPipelines) == 0:
-		return errors.New("no root pipeline")
-	case len(rootPipelines) > 1:
-		names := strings.Join(rootPipelines, ", ")
-		return errors.Errorf("multiple root pipelines: %s", names)
 	}
 
-	// check for cycles
-	cycle := checkForCycles(workflow, rootPipelines[0])
+	// check for cycles, starting from every root so disconnected parts of
+	// the workflow are checked too
+	cycle := checkForCycles(workflow)
 	if len(cycle) != 0 {
 		cycleString := strings.Join(cycle, " -> ")
 		return errors.Errorf("contains cycle %s", cycleString)
 	}
 
+	if len(workflow.RootPipelines()) == 0 {
+		return errors.New("no root pipeline")
+	}
+
 	return nil
 }
 
-// checkForCycles uses Depth-First Traversal to detect cycles.
+// RootPipelines returns the names of the pipelines of the workflow that do
+// not require any other pipeline, they all start from the project's source.
+func (workflow *WorkflowConfig) RootPipelines() []string {
+	rootPipelines := []string{}
+	for _, pipeline := range workflow.Pipelines {
+		if len(pipeline.Requires) == 0 {
+			rootPipelines = append(rootPipelines, pipeline.Name)
+		}
+	}
+	return rootPipelines
+}
+
+// checkForCycles uses Depth-First Traversal from every root pipeline, and
+// then from every pipeline that was not reached, to detect cycles.
 // Returns a list of pipeline names which form the cycle, or nil if
 // there are no cycles.
-func checkForCycles(workflow *WorkflowConfig, rootPipeline string) []string {
+func checkForCycles(workflow *WorkflowConfig) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
 	visited := []string{}
-	visitedMap := map[string][]string{}
-	traverseItems := []string{rootPipeline}
 
-	for len(traverseItems) > 0 {
-		current := traverseItems[len(traverseItems)-1]
-		traverseItems = traverseItems[:len(traverseItems)-1]
-
-		// if the current node is in the visited list then
-		// there's a cycle
-		if util.ContainsString(visited, current) {
+	var visit func(current string) []string
+	visit = func(current string) []string {
+		switch state[current] {
+		case visiting:
+			// current is on the path that led here, there's a cycle
 			return extractCycle(visited, current)
+		case done:
+			return nil
 		}
-
+		state[current] = visiting
 		visited = append(visited, current)
 
-		for _, pipeline := range workflow.Pipelines {
+		// The pipelines requiring current are visited last to first
+		for i := len(workflow.Pipelines) - 1; i >= 0; i-- {
+			pipeline := workflow.Pipelines[i]
 			if util.ContainsString(pipeline.Requires, current) {
-				traverseItems = append(traverseItems, pipeline.Name)
-				currentVisited := make([]string, len(visited))
-				copy(currentVisited, visited)
-				visitedMap[pipeline.Name] = currentVisited
+				if cycle := visit(pipeline.Name); cycle != nil {
+					return cycle
+				}
 			}
 		}
 
-		if len(traverseItems) > 0 {
-			topStack := traverseItems[len(traverseItems)-1]
-			v := visitedMap[topStack]
-			visited = make([]string, len(v))
-			copy(visited, v)
-		}
+		visited = visited[:len(visited)-1]
+		state[current] = done
+		return nil
 	}
 
+	starts := workflow.RootPipelines()
+	for _, pipeline := range workflow.Pipelines {
+		starts = append(starts, pipeline.Name)
+	}
+	for _, start := range starts {
+		if cycle := visit(start); cycle != nil {
+			return cycle
+		}
+	}
 	return nil
 }
 
@@ -388,8 +740,13 @@ type Config struct {
 	Services          []*RawBoxConfig `yaml:"services"`
 	SourceDir         string          `yaml:"source-dir"`
 	IgnoreFile        string          `yaml:"ignore-file"`
+	Env               EnvConfig       `yaml:"env"`
 	PipelinesMap      map[string]*RawPipelineConfig
-	Workflows         []*WorkflowConfig `yaml:"workflows"`
+	Templates         map[string]*RawPipelineConfig `yaml:"templates"`
+	Workflows         []*WorkflowConfig             `yaml:"workflows"`
+	// PipelineSources maps every pipeline to the file it was defined in, it
+	// is set by ConfigFromYamlFile
+	PipelineSources map[string]string `yaml:"-"`
 }
 
 // GetWorkflow returns the workflow by name.
@@ -422,9 +779,12 @@ type RawConfig struct {
 var configReservedWords = map[string]struct{}{
 	"box":                 struct{}{},
 	"command-timeout":     struct{}{},
+	"env":                 struct{}{},
+	"include":             struct{}{},
 	"no-response-timeout": struct{}{},
 	"services":            struct{}{},
 	"source-dir":          struct{}{},
+	"templates":           struct{}{},
 	"workflows":           struct{}{},
 }
 
@@ -467,7 +827,8 @@ func (r *RawConfig) IsValid() error {
 	return nil
 }
 
-func findYaml(searchDirs []string) (string, error) {
+// FindWerckerYaml returns the path of the first wercker.yml found in searchDirs
+func FindWerckerYaml(searchDirs []string) (string, error) {
 	possibleYaml := []string{"ewok.yml", "wercker.yml", ".wercker.yml"}
 
 	for _, v := range searchDirs {
@@ -486,35 +847,66 @@ func findYaml(searchDirs []string) (string, error) {
 	return "", fmt.Errorf("No wercker.yml found")
 }
 
-// ReadWerckerYaml will try to find a wercker.yml file and return its bytes.
-// TODO(termie): If allowDefault is true it will try to generate a
-// default yaml file by inspecting the project.
-func ReadWerckerYaml(searchDirs []string, allowDefault bool) ([]byte, error) {
-	foundYaml, err := findYaml(searchDirs)
+// ReadWerckerYaml will try to find a wercker.yml file and return its path and
+// bytes. If allowDefault is true and there is none, a default yaml file is
+// generated for the project detected in the first of searchDirs and printed
+// so it can be saved, its path is the wercker.yml it would be saved as. The
+// build pipeline has a single box, so when there are several projects only
+// the first one is built.
+func ReadWerckerYaml(searchDirs []string, allowDefault bool) (string, []byte, error) {
+	foundYaml, err := FindWerckerYaml(searchDirs)
 	if err != nil {
-		return nil, err
+		if !allowDefault || len(searchDirs) == 0 {
+			return "", nil, err
+		}
+		projects, detectErr := DetectProjects(searchDirs[0])
+		if detectErr != nil {
+			return "", nil, err
+		}
+		logger := util.RootLogger().WithField("Logger", "Config")
+		if len(projects) > 1 {
+			logger.Warnf("Found %d projects, only the one in %s is built. Run wercker detect to generate a wercker.yml that builds all of them.", len(projects), projects[0].Dir)
+			projects = projects[:1]
+		}
+		werckerYaml := GenerateConfigYaml(projects)
+		stack := DefaultStack
+		if len(projects) > 0 {
+			stack = projects[0].Stack
+		}
+		logger.Warnf("No wercker.yml found, using a default for a %s project. Save it as wercker.yml to change it:\n\n%s", stack, werckerYaml)
+		return path.Join(searchDirs[0], "wercker.yml"), werckerYaml, nil
 	}
 
-	// TODO(termie): If allowDefault, we'd generate something here
-	// if !allowDefault && !found {
-	//   return nil, errors.New("No wercker.yml found and no defaults allowed.")
-	// }
-
-	return ioutil.ReadFile(foundYaml)
+	werckerYaml, err := ioutil.ReadFile(foundYaml)
+	if err != nil {
+		return "", nil, err
+	}
+	return foundYaml, werckerYaml, nil
 }
 
 // ConfigFromYaml reads a []byte as yaml and turn it into a Config object
 func ConfigFromYaml(file []byte) (*Config, error) {
 	var m RawConfig
-	err := yaml.Unmarshal(file, &m)
+	if err := yaml.Unmarshal(file, &m); err != nil {
+		return nil, fmt.Errorf("Error parsing your wercker.yml:\n  %s", err.Error())
+	}
+	return resolveConfig(&m)
+}
+
+// resolveConfig checks the parsed m and resolves the extends and matrices of
+// its pipelines
+func resolveConfig(m *RawConfig) (*Config, error) {
 	// also need to ensure the RawConfig is valid before sending it back
+	if err := m.IsValid(); err != nil {
+		return nil, fmt.Errorf("Error parsing your wercker.yml:\n  %s", err.Error())
+	}
+
+	err := m.Config.ResolveExtends()
 	if err == nil {
-		err = m.IsValid()
+		err = m.Config.ExpandMatrices()
 	}
 	if err != nil {
-		errStr := err.Error()
-		err = fmt.Errorf("Error parsing your wercker.yml:\n  %s", errStr)
-		return nil, err
+		return nil, fmt.Errorf("Error parsing your wercker.yml:\n  %s", err.Error())
 	}
 
 	return m.Config, nil
@@ -25,6 +25,7 @@ import (
 	"github.com/wercker/docker-check-access"
 	"github.com/wercker/wercker/auth"
 	"github.com/wercker/wercker/util"
+	"gopkg.in/yaml.v2"
 )
 
 type ConfigSuite struct {
@@ -100,28 +101,108 @@ func (s *ConfigSuite) TestConfigBoxStructs() {
 	s.Equal(ok, true)
 }
 
-func (s *ConfigSuite) TestIfaceToString() {
+func (s *ConfigSuite) TestYamlValue() {
 	tests := []struct {
-		input    interface{}
+		input    string
 		expected string
 	}{
 		{"string input", "string input"},
-		{int(1234), "1234"},
-		{int32(123432), "123432"},
-		{int64(123464), "123464"},
-		{true, "true"},
-		{false, "false"},
-
-		// The following types are not supported, so a empty string is returned
-		{nil, ""},
-		{float32(123.123), ""},
-		{float64(123.123), ""},
+		{"1234", "1234"},
+		{"1.10", "1.10"},
+		{"0755", "0755"},
+		{`"1.10"`, "1.10"},
+		{"true", "true"},
+		{"~", ""},
+		{"0.5", "0.5"},
+		{"[a, 1, 1.10, true]", "a\n1\n1.10\ntrue"},
+		{"[a, [b]]", `["a",["b"]]`},
+		{"{b: 1, a: [x]}", `{"a":["x"],"b":1}`},
 	}
 
 	for _, test := range tests {
-		actual := ifaceToString(test.input)
-		s.Equal(test.expected, actual, "")
+		var value *yamlValue
+		s.Require().Nil(yaml.Unmarshal([]byte(test.input), &value))
+		actual, err := value.toString()
+		s.Nil(err)
+		s.Equal(test.expected, actual, test.input)
 	}
+
+	// The following values can not be represented
+	for _, input := range []string{".inf", "[.nan]"} {
+		var value *yamlValue
+		s.Require().Nil(yaml.Unmarshal([]byte(input), &value))
+		_, err := value.toString()
+		s.NotNil(err, input)
+	}
+}
+
+func (s *ConfigSuite) TestConfigStepStructuredData() {
+	config, err := ConfigFromYaml([]byte(`
+build:
+  steps:
+    - internal/docker-push:
+        name: push
+        tags:
+          - latest
+          - v1
+        ports: [80, 443]
+        labels:
+          maintainer: wercker
+        ratio: 1.5
+        go-version: 1.10
+        go-versions: [1.10, "1.11", 1.20]
+        empty:
+`))
+	s.Require().Nil(err)
+	step := config.PipelinesMap["build"].Steps[0]
+	s.Equal("1.10", step.Data["go-version"])
+	s.Equal("1.10\n1.11\n1.20", step.Data["go-versions"])
+	s.Equal("", step.Data["empty"])
+	s.Equal("latest\nv1", step.Data["tags"])
+	s.Equal("80\n443", step.Data["ports"])
+	s.Equal(`{"maintainer":"wercker"}`, step.Data["labels"])
+	s.Equal("1.5", step.Data["ratio"])
+	s.Equal([]interface{}{"latest", "v1"}, step.RawData["tags"])
+	s.Equal(map[string]interface{}{"maintainer": "wercker"}, step.RawData["labels"])
+	_, ok := step.RawData["name"]
+	s.False(ok)
+
+	_, err = ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: make
+        limit: .inf
+`))
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "Step script has an unsupported value for limit")
+}
+
+func (s *ConfigSuite) TestConfigStepDataKeepsScalars() {
+	config, err := ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: go test ./...
+        go-version: 1.10
+    - script:
+      code: go vet ./...
+      go-version: 1.10
+  production:
+    - script:
+        go-version: 1.20
+        mode: 0755
+`))
+	s.Require().Nil(err)
+	build := config.PipelinesMap["build"]
+	s.Equal("1.10", build.Steps[0].Data["go-version"])
+	s.Equal(1.1, build.Steps[0].RawData["go-version"])
+	s.Equal("1.10", build.Steps[1].Data["go-version"])
+
+	target := build.StepsMap["production"]
+	s.Require().Len(target, 1)
+	s.Equal("1.20", target[0].Data["go-version"])
+	s.Equal("0755", target[0].Data["mode"])
 }
 
 func (s *ConfigSuite) TestWorkflowValidation() {
@@ -146,7 +227,11 @@ func (s *ConfigSuite) TestWorkflowValidation() {
 		{"nonUnique", "duplicate pipeline build"},
 		{"doNotExist", "pipeline missingbuild is not defined"},
 		{"missingRequired", "no pipeline missingbuild required by echoa"},
-		{"multipleRoots", "multiple root pipelines: build, echoa"},
+		{"multipleRoots", ""},
+		{"multipleRootsFanin", ""},
+		{"disconnected", ""},
+		{"rootlessCycle", "contains cycle echoa -> echob -> echoa"},
+		{"badFilter", `pipeline build: invalid filter "src/[a"`},
 	}
 
 	for _, test := range tests {
@@ -161,3 +246,375 @@ func (s *ConfigSuite) TestWorkflowValidation() {
 		s.Equal(test.expectedErrorString, actual)
 	}
 }
+
+func (s *ConfigSuite) TestConfigExtends() {
+	b, err := ioutil.ReadFile("../tests/pipeline_extends.yml")
+	s.Nil(err)
+	config, err := ConfigFromYaml(b)
+	s.Require().Nil(err)
+
+	stepNames := func(steps RawStepsConfig) []string {
+		names := []string{}
+		for _, step := range steps {
+			names = append(names, step.Name)
+		}
+		return names
+	}
+
+	build := config.PipelinesMap["build"]
+	s.Equal("golang", build.Box.ID)
+	s.Equal([]string{"setup", "test", "build"}, stepNames(build.Steps))
+	s.Equal([]string{"notify"}, stepNames(build.AfterSteps))
+	s.Require().Len(build.Services, 1)
+	s.Equal("redis", build.Services[0].ID)
+
+	lint := config.PipelinesMap["lint"]
+	s.Equal("golang:alpine", lint.Box.ID)
+	s.Equal([]string{"lint", "setup"}, stepNames(lint.Steps))
+	s.Equal([]string{"report"}, stepNames(lint.AfterSteps))
+	s.Require().Len(lint.Services, 1)
+	s.Equal("postgres", lint.Services[0].ID)
+
+	_, ok := config.PipelinesMap["base"]
+	s.False(ok, "templates should not be runnable pipelines")
+}
+
+func (s *ConfigSuite) TestConfigExtendsErrors() {
+	tests := []struct {
+		yaml     string
+		expected string
+	}{
+		{
+			"build:\n  extends: missing\n",
+			"pipeline build extends unknown pipeline or template missing",
+		},
+		{
+			"a:\n  extends: b\nb:\n  extends: a\n",
+			"pipeline inheritance contains cycle a -> b -> a",
+		},
+		{
+			"templates:\n  base:\n    extends: base\nbuild:\n  extends: base\n",
+			"pipeline inheritance contains cycle base -> base",
+		},
+		{
+			"base:\n  box: alpine\nbuild:\n  extends: base\n  merge:\n    box: replace\n",
+			"cannot set a merge strategy for box",
+		},
+		{
+			"build:\n  merge:\n    steps: prepend\n",
+			"pipeline build: sets merge without extends",
+		},
+		{
+			"base:\n  box: alpine\nbuild:\n  merge:\n    steps: apend\n",
+			"pipeline build: sets merge without extends",
+		},
+		{
+			"base:\n  box: alpine\nbuild:\n  extends: base\n  merge:\n    steps: apend\n",
+			"unknown merge strategy apend for steps",
+		},
+		{
+			"templates:\n  base:\n    box: alpine\n  go:\n    extends: base\n    merge:\n      after-step: replace\n",
+			"template go: cannot set a merge strategy for after-step",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := ConfigFromYaml([]byte(test.yaml))
+		s.Require().NotNil(err)
+		s.Contains(err.Error(), test.expected)
+	}
+}
+
+func (s *ConfigSuite) TestConfigExtendsReplaceEmpty() {
+	config, err := ConfigFromYaml([]byte(`
+templates:
+  base:
+    services:
+      - redis
+    steps:
+      - script:
+          code: make
+    after-steps:
+      - script:
+          code: notify
+build:
+  extends: base
+  merge:
+    steps: replace
+    after-steps: replace
+    services: replace
+  after-steps: []
+  services: []
+`))
+	s.Require().Nil(err)
+	build := config.PipelinesMap["build"]
+	s.Len(build.Steps, 1, "an unset section keeps the parent's entries")
+	s.Empty(build.AfterSteps)
+	s.Empty(build.Services)
+}
+
+func (s *ConfigSuite) TestConfigStepWhen() {
+	config, err := ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: make deploy
+        when: branch == "master"
+`))
+	s.Require().Nil(err)
+	step := config.PipelinesMap["build"].Steps[0]
+	s.Equal(`branch == "master"`, step.When)
+	_, ok := step.Data["when"]
+	s.False(ok)
+
+	_, err = ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: make deploy
+        when: branch ==
+`))
+	s.NotNil(err)
+}
+
+func (s *ConfigSuite) TestConfigEnv() {
+	config, err := ConfigFromYaml([]byte(`
+env:
+  B: global
+  A: "1"
+  GO_VERSION: 1.10
+  EMPTY:
+templates:
+  base:
+    env:
+      LEVEL: info
+      REGION: eu
+build:
+  extends: base
+  env:
+    LEVEL: debug
+  steps:
+    - script:
+        code: env
+`))
+	s.Require().Nil(err)
+	s.Equal(EnvConfig{{"B", "global"}, {"A", "1"}, {"GO_VERSION", "1.10"}, {"EMPTY", ""}}, config.Env)
+	s.Equal(EnvConfig{{"LEVEL", "info"}, {"REGION", "eu"}, {"LEVEL", "debug"}}, config.PipelinesMap["build"].Env)
+	_, ok := config.PipelinesMap["env"]
+	s.False(ok)
+}
+
+func (s *ConfigSuite) TestConfigTimeouts() {
+	config, err := ConfigFromYaml([]byte(`
+build:
+  timeout: 45
+  steps:
+    - script:
+        code: make integration
+        timeout: 40
+        no-response-timeout: 15
+    - script:
+        code: make lint
+`))
+	s.Require().Nil(err)
+	pipeline := config.PipelinesMap["build"]
+	s.Equal(45, pipeline.Timeout)
+	s.Equal(40, pipeline.Steps[0].Timeout)
+	s.Equal(15, pipeline.Steps[0].NoResponseTimeout)
+	_, ok := pipeline.Steps[0].Data["timeout"]
+	s.False(ok)
+	s.Equal(0, pipeline.Steps[1].Timeout)
+
+	_, err = ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: make
+        timeout: soon
+`))
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), `Step script has an invalid timeout "soon"`)
+}
+
+func (s *ConfigSuite) TestConfigAllowFailure() {
+	config, err := ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: make coverage
+        allow-failure: true
+    - script:
+        code: make lint
+        continue-on-error: "true"
+    - script:
+        code: make
+`))
+	s.Require().Nil(err)
+	steps := config.PipelinesMap["build"].Steps
+	s.True(steps[0].AllowFailure)
+	s.True(steps[1].AllowFailure)
+	_, ok := steps[0].Data["allow-failure"]
+	s.False(ok)
+	s.False(steps[2].AllowFailure)
+
+	_, err = ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: make
+        allow-failure: maybe
+`))
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), `Step script has an invalid allow-failure "maybe"`)
+}
+
+func (s *ConfigSuite) TestConfigResultSteps() {
+	config, err := ConfigFromYaml([]byte(`
+base:
+  box: golang
+  on-failure:
+    - script:
+        name: page
+  always:
+    - script:
+        name: cleanup
+build:
+  extends: base
+  merge:
+    always: prepend
+  steps:
+    - script:
+        code: make
+  on-success:
+    - script:
+        name: deploy
+  always:
+    - script:
+        name: report
+`))
+	s.Require().Nil(err)
+
+	stepNames := func(steps RawStepsConfig) []string {
+		names := []string{}
+		for _, step := range steps {
+			names = append(names, step.Name)
+		}
+		return names
+	}
+
+	build := config.PipelinesMap["build"]
+	s.Equal([]string{"deploy"}, stepNames(build.OnSuccess))
+	s.Equal([]string{"page"}, stepNames(build.OnFailure))
+	s.Equal([]string{"report", "cleanup"}, stepNames(build.Always))
+	s.Len(build.AfterSteps, 0)
+}
+
+func (s *ConfigSuite) TestConfigParallel() {
+	config, err := ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: go get ./...
+    - parallel:
+        - script:
+            name: lint
+            code: make lint
+        - script:
+            name: test
+            code: make test
+            allow-failure: true
+`))
+	s.Require().Nil(err)
+	steps := config.PipelinesMap["build"].Steps
+	s.Require().Len(steps, 2)
+	s.Equal("parallel", steps[1].ID)
+	s.Require().Len(steps[1].Parallel, 2)
+	s.Equal("lint", steps[1].Parallel[0].Name)
+	s.Equal("make test", steps[1].Parallel[1].Data["code"])
+	s.True(steps[1].Parallel[1].AllowFailure)
+
+	_, err = ConfigFromYaml([]byte(`
+build:
+  steps:
+    - parallel:
+        - parallel:
+            - script:
+                code: make
+`))
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "Step parallel can not contain another parallel group")
+
+	_, err = ConfigFromYaml([]byte(`
+build:
+  steps:
+    - parallel: []
+`))
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "Step parallel has no steps")
+}
+
+func (s *ConfigSuite) TestConfigMatrix() {
+	config, err := ConfigFromYaml([]byte(`
+box: golang
+build:
+  matrix:
+    tags:
+      - "1.10"
+      - "1.11"
+    env:
+      - GO111MODULE: "on"
+      - GO111MODULE: "off"
+  steps:
+    - script:
+        code: go test ./...
+`))
+	s.Require().Nil(err)
+
+	build := config.PipelinesMap["build"]
+	s.Equal([]string{"build-1", "build-2", "build-3", "build-4"}, build.MatrixPipelines)
+
+	expanded := config.PipelinesMap["build-3"]
+	s.Require().NotNil(expanded)
+	s.Equal("build", expanded.MatrixParent)
+	s.Equal("golang", expanded.Box.ID)
+	s.Equal("1.11", expanded.Box.Tag)
+	s.Equal([][]string{{"GO111MODULE", "on"}}, expanded.MatrixExpansion.Env)
+	s.Equal("tag=1.11 GO111MODULE=on", expanded.MatrixExpansion.Label())
+	s.Len(expanded.Steps, 1)
+
+	// The global box is left alone
+	s.Equal("", config.Box.Tag)
+}
+
+func (s *ConfigSuite) TestConfigMatrixExtends() {
+	config, err := ConfigFromYaml([]byte(`
+box: golang
+templates:
+  go:
+    matrix:
+      tags:
+        - "1.10"
+        - "1.11"
+build:
+  extends: go
+  steps:
+    - script:
+        code: go test ./...
+lint:
+  extends: build
+  matrix:
+    tags:
+      - "1.11"
+  steps:
+    - script:
+        code: go vet ./...
+`))
+	s.Require().Nil(err)
+	s.Equal([]string{"build-1", "build-2"}, config.PipelinesMap["build"].MatrixPipelines)
+	s.Equal("1.10", config.PipelinesMap["build-1"].Box.Tag)
+
+	// A matrix of its own replaces the inherited one
+	s.Equal([]string{"lint-1"}, config.PipelinesMap["lint"].MatrixPipelines)
+	s.Equal("1.11", config.PipelinesMap["lint-1"].Box.Tag)
+	s.Len(config.PipelinesMap["lint-1"].Steps, 2)
+}
@@ -0,0 +1,630 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultStack is used for projects whose stack is not detected
+const DefaultStack = "default"
+
+// maxDetectDepth is how deep DetectProjects looks for subprojects
+const maxDetectDepth = 3
+
+// DetectedProject is a project found by DetectProjects
+type DetectedProject struct {
+	// Dir is the directory of the project relative to the directory that
+	// was inspected, "." for that directory itself
+	Dir   string
+	Stack string
+	// Version is the version of the language the project asks for, it is
+	// used as the tag of the box
+	Version  string
+	Services []*BoxConfig
+}
+
+// Box returns the box to build the project with
+func (p *DetectedProject) Box() string {
+	box := stackBox(p.Stack)
+	if p.Version != "" {
+		box += ":" + p.Version
+	}
+	return box
+}
+
+// languageStacks are detected in this order by the files they need
+var languageStacks = []struct {
+	stack string
+	match func(name string, root bool) bool
+}{
+	{"golang", func(name string, root bool) bool {
+		// Packages below the root are part of the root project unless they
+		// are a module of their own
+		return name == "go.mod" || (root && filepath.Ext(name) == ".go")
+	}},
+	{"nodejs", fileNamed("package.json")},
+	{"python", fileNamed("requirements.txt", "setup.py", "pyproject.toml", "Pipfile")},
+	{"ruby", fileNamed("Gemfile")},
+	{"java-maven", fileNamed("pom.xml")},
+	{"java-gradle", func(name string, root bool) bool {
+		return filepath.Ext(name) == ".gradle" || strings.HasSuffix(name, ".gradle.kts") || name == "gradlew"
+	}},
+	{"rust", fileNamed("Cargo.toml")},
+	{"dotnet", func(name string, root bool) bool {
+		switch filepath.Ext(name) {
+		case ".csproj", ".fsproj", ".sln":
+			return true
+		}
+		return false
+	}},
+	{"php", fileNamed("composer.json")},
+	{"elixir", fileNamed("mix.exs")},
+}
+
+func fileNamed(names ...string) func(string, bool) bool {
+	return func(name string, root bool) bool {
+		for _, n := range names {
+			if name == n {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// skipDetectDirs are never inspected for projects
+var skipDetectDirs = map[string]struct{}{
+	"node_modules":     struct{}{},
+	"bower_components": struct{}{},
+	"vendor":           struct{}{},
+	"target":           struct{}{},
+	"_build":           struct{}{},
+	"_builds":          struct{}{},
+	"_projects":        struct{}{},
+	"_steps":           struct{}{},
+	"_cache":           struct{}{},
+	"deps":             struct{}{},
+	"__pycache__":      struct{}{},
+	"venv":             struct{}{},
+}
+
+// DetectStack inspects the files in dir and returns the stack of the project
+// in it, or DefaultStack when it does not recognize any.
+func DetectStack(dir string) (string, error) {
+	stacks, err := detectStacks(dir, true)
+	if err != nil {
+		return "", err
+	}
+	if len(stacks) == 0 {
+		return DefaultStack, nil
+	}
+	return stacks[0], nil
+}
+
+// detectStacks returns every stack found in dir. Makefile and Dockerfile
+// projects are only reported when there is no language stack.
+func detectStacks(dir string, root bool) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stacks := []string{}
+	for _, language := range languageStacks {
+		for _, f := range files {
+			if !f.IsDir() && language.match(f.Name(), root) {
+				stacks = append(stacks, language.stack)
+				break
+			}
+		}
+	}
+	if len(stacks) > 0 {
+		return stacks, nil
+	}
+	for _, f := range files {
+		if f.Name() == "Makefile" {
+			return []string{"make"}, nil
+		}
+	}
+	for _, f := range files {
+		if f.Name() == "Dockerfile" {
+			return []string{"docker"}, nil
+		}
+	}
+	return stacks, nil
+}
+
+// DetectProjects looks for projects in root and its subdirectories, so every
+// project of a monorepo is found. The subdirectories of a project are not
+// inspected, except for those of root itself. A Makefile or Dockerfile in
+// root is only used when there are no other projects.
+func DetectProjects(root string) ([]*DetectedProject, error) {
+	rootStacks, err := detectStacks(root, true)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := []*DetectedProject{}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := skipDetectDirs[info.Name()]; ok || strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if strings.Count(rel, string(filepath.Separator)) >= maxDetectDepth {
+			return filepath.SkipDir
+		}
+
+		stacks, err := detectStacks(path, false)
+		if err != nil {
+			return err
+		}
+		for _, stack := range stacks {
+			projects = append(projects, detectProject(root, filepath.ToSlash(rel), stack))
+		}
+		if len(stacks) > 0 && stacks[0] != "make" && stacks[0] != "docker" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rootProjects := []*DetectedProject{}
+	for _, stack := range rootStacks {
+		if (stack == "make" || stack == "docker") && len(projects) > 0 {
+			continue
+		}
+		rootProjects = append(rootProjects, detectProject(root, ".", stack))
+	}
+	return append(rootProjects, projects...), nil
+}
+
+func detectProject(root, dir, stack string) *DetectedProject {
+	path := filepath.Join(root, filepath.FromSlash(dir))
+	return &DetectedProject{
+		Dir:      dir,
+		Stack:    stack,
+		Version:  detectVersion(path, stack),
+		Services: detectServices(path),
+	}
+}
+
+// versionFiles are the files that pin the language version of a stack, in
+// the order they are looked at, .tool-versions is looked at last
+var versionFiles = map[string][]string{
+	"nodejs": {".nvmrc", ".node-version"},
+	"python": {".python-version", "runtime.txt"},
+	"ruby":   {".ruby-version"},
+	"rust":   {"rust-toolchain"},
+}
+
+// toolVersionsNames are the names stacks have in asdf's .tool-versions
+var toolVersionsNames = map[string]string{
+	"golang": "golang",
+	"nodejs": "nodejs",
+	"python": "python",
+	"ruby":   "ruby",
+	"rust":   "rust",
+	"elixir": "elixir",
+}
+
+var (
+	versionPattern   = regexp.MustCompile(`\d+(\.\d+)*`)
+	goVersionPattern = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`)
+)
+
+// detectVersion returns the version of the language the project in dir
+// pins, shortened to the part boxes are tagged with
+func detectVersion(dir, stack string) string {
+	version := ""
+	switch stack {
+	case "golang":
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			if m := goVersionPattern.FindSubmatch(b); m != nil {
+				version = string(m[1])
+			}
+		}
+	case "dotnet":
+		var global struct {
+			SDK struct {
+				Version string `json:"version"`
+			} `json:"sdk"`
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "global.json")); err == nil && json.Unmarshal(b, &global) == nil {
+			version = global.SDK.Version
+		}
+	default:
+		for _, name := range versionFiles[stack] {
+			if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err == nil {
+				version = firstLine(b)
+				break
+			}
+		}
+	}
+	if version == "" {
+		if name, ok := toolVersionsNames[stack]; ok {
+			version = toolVersion(dir, name)
+		}
+	}
+
+	version = versionPattern.FindString(version)
+	if version == "" {
+		return ""
+	}
+	parts := strings.Split(version, ".")
+	switch {
+	case stack == "nodejs":
+		parts = parts[:1]
+	case len(parts) > 2:
+		parts = parts[:2]
+	}
+	return strings.Join(parts, ".")
+}
+
+// toolVersion returns the version of tool in the .tool-versions in dir
+func toolVersion(dir, tool string) string {
+	f, err := os.Open(filepath.Join(dir, ".tool-versions"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == tool {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+func firstLine(b []byte) string {
+	return strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+}
+
+// serviceBoxes are the services that are recognized, with the environment
+// their images need to start
+var serviceBoxes = map[string]map[string]string{
+	"postgres":      {"POSTGRES_PASSWORD": "postgres"},
+	"mysql":         {"MYSQL_ROOT_PASSWORD": "mysql"},
+	"mariadb":       {"MYSQL_ROOT_PASSWORD": "mariadb"},
+	"redis":         nil,
+	"mongo":         nil,
+	"rabbitmq":      nil,
+	"memcached":     nil,
+	"elasticsearch": {"discovery.type": "single-node"},
+}
+
+// serviceDrivers recognize the services a project needs by the drivers in
+// its manifests
+var serviceDrivers = []struct {
+	file    string
+	pattern *regexp.Regexp
+	service string
+}{
+	{"package.json", regexp.MustCompile(`"(pg|postgres)"\s*:`), "postgres"},
+	{"package.json", regexp.MustCompile(`"(mysql|mysql2)"\s*:`), "mysql"},
+	{"package.json", regexp.MustCompile(`"(redis|ioredis)"\s*:`), "redis"},
+	{"package.json", regexp.MustCompile(`"(mongodb|mongoose)"\s*:`), "mongo"},
+	{"package.json", regexp.MustCompile(`"amqplib"\s*:`), "rabbitmq"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^(psycopg2|psycopg2-binary|asyncpg)\b`), "postgres"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^(mysqlclient|pymysql|mysql-connector-python)\b`), "mysql"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^redis\b`), "redis"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^pymongo\b`), "mongo"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^pika\b`), "rabbitmq"},
+	{"Gemfile", regexp.MustCompile(`gem\s+['"]pg['"]`), "postgres"},
+	{"Gemfile", regexp.MustCompile(`gem\s+['"]mysql2['"]`), "mysql"},
+	{"Gemfile", regexp.MustCompile(`gem\s+['"]redis['"]`), "redis"},
+	{"Gemfile", regexp.MustCompile(`gem\s+['"]mongoid['"]`), "mongo"},
+	{"go.mod", regexp.MustCompile(`github\.com/(lib/pq|jackc/pgx)`), "postgres"},
+	{"go.mod", regexp.MustCompile(`github\.com/go-sql-driver/mysql`), "mysql"},
+	{"go.mod", regexp.MustCompile(`github\.com/(go-redis/redis|gomodule/redigo)`), "redis"},
+	{"go.mod", regexp.MustCompile(`go\.mongodb\.org/mongo-driver`), "mongo"},
+	{"Cargo.toml", regexp.MustCompile(`(?m)^(postgres|tokio-postgres)\s*=`), "postgres"},
+	{"Cargo.toml", regexp.MustCompile(`(?m)^redis\s*=`), "redis"},
+	{"mix.exs", regexp.MustCompile(`:postgrex\b`), "postgres"},
+	{"mix.exs", regexp.MustCompile(`:myxql\b`), "mysql"},
+	{"mix.exs", regexp.MustCompile(`:redix\b`), "redis"},
+	{"composer.json", regexp.MustCompile(`"predis/predis"`), "redis"},
+	{"pom.xml", regexp.MustCompile(`<artifactId>postgresql</artifactId>`), "postgres"},
+	{"pom.xml", regexp.MustCompile(`<artifactId>mysql-connector-java</artifactId>`), "mysql"},
+	{"build.gradle", regexp.MustCompile(`org\.postgresql:postgresql`), "postgres"},
+	{"build.gradle", regexp.MustCompile(`mysql:mysql-connector-java`), "mysql"},
+}
+
+var composeFiles = []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"}
+
+// detectServices returns the services the project in dir needs, from the
+// images in its docker-compose file and the drivers in its manifests
+func detectServices(dir string) []*BoxConfig {
+	images := map[string]string{}
+	for _, name := range composeFiles {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var compose struct {
+			Services map[string]struct {
+				Image string `yaml:"image"`
+			} `yaml:"services"`
+		}
+		if yaml.Unmarshal(b, &compose) != nil {
+			continue
+		}
+		for _, service := range compose.Services {
+			if service.Image == "" {
+				continue
+			}
+			name := strings.SplitN(service.Image, ":", 2)[0]
+			name = name[strings.LastIndex(name, "/")+1:]
+			if _, ok := serviceBoxes[name]; ok {
+				images[name] = service.Image
+			}
+		}
+		break
+	}
+
+	manifests := map[string][]byte{}
+	for _, driver := range serviceDrivers {
+		if _, ok := images[driver.service]; ok {
+			continue
+		}
+		b, ok := manifests[driver.file]
+		if !ok {
+			b, _ = ioutil.ReadFile(filepath.Join(dir, driver.file))
+			manifests[driver.file] = b
+		}
+		if driver.pattern.Match(b) {
+			images[driver.service] = driver.service
+		}
+	}
+
+	names := []string{}
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	services := []*BoxConfig{}
+	for _, name := range names {
+		services = append(services, &BoxConfig{ID: images[name], Env: serviceBoxes[name]})
+	}
+	return services
+}
+
+// stackDefaults is the box and the build steps used for a stack when a
+// project does not have a wercker.yml
+type stackDefaults struct {
+	box   string
+	steps [][]string // name and code of script steps
+}
+
+var defaultStacks = map[string]stackDefaults{
+	"nodejs": {"node", [][]string{
+		{"install dependencies", "npm install"},
+		{"test", "npm test"},
+	}},
+	"python": {"python", [][]string{
+		{"install dependencies", "if [ -f requirements.txt ]; then pip install -r requirements.txt; else pip install .; fi"},
+		{"test", "python -m unittest discover"},
+	}},
+	"ruby": {"ruby", [][]string{
+		{"install dependencies", "bundle install"},
+		{"test", "bundle exec rake"},
+	}},
+	"golang": {"golang", [][]string{
+		{"install dependencies", "go get -t -v ./..."},
+		{"build", "go build ./..."},
+		{"test", "go test ./..."},
+	}},
+	"java-maven": {"maven", [][]string{
+		{"build", "mvn -B package"},
+	}},
+	"java-gradle": {"gradle", [][]string{
+		{"build", "if [ -x gradlew ]; then ./gradlew build; else gradle build; fi"},
+	}},
+	"rust": {"rust", [][]string{
+		{"build", "cargo build"},
+		{"test", "cargo test"},
+	}},
+	"dotnet": {"mcr.microsoft.com/dotnet/sdk", [][]string{
+		{"restore", "dotnet restore"},
+		{"build", "dotnet build --no-restore"},
+		{"test", "dotnet test --no-build"},
+	}},
+	"php": {"composer", [][]string{
+		{"install dependencies", "composer install --no-interaction"},
+		{"test", "if [ -x vendor/bin/phpunit ]; then vendor/bin/phpunit; fi"},
+	}},
+	"elixir": {"elixir", [][]string{
+		{"install dependencies", "mix local.hex --force && mix local.rebar --force && mix deps.get"},
+		{"test", "mix test"},
+	}},
+	"make": {"buildpack-deps", [][]string{
+		{"build", "make"},
+	}},
+	"docker": {"alpine", nil},
+	DefaultStack: {"alpine", [][]string{
+		{"build", "echo \"Add the steps to build your project to wercker.yml\""},
+	}},
+}
+
+func stackBox(stack string) string {
+	if defaults, ok := defaultStacks[stack]; ok {
+		return defaults.box
+	}
+	return defaultStacks[DefaultStack].box
+}
+
+// DefaultConfigYaml returns a wercker.yml with a build pipeline for stack,
+// unknown stacks get the one for DefaultStack
+func DefaultConfigYaml(stack string) []byte {
+	if _, ok := defaultStacks[stack]; !ok {
+		stack = DefaultStack
+	}
+	return GenerateConfigYaml([]*DetectedProject{{Dir: ".", Stack: stack}})
+}
+
+// GenerateConfigYaml returns a wercker.yml for projects. A single project is
+// built by the build pipeline. For several projects the build pipeline
+// passes the source on to a pipeline for each project, and a workflow runs
+// them.
+func GenerateConfigYaml(projects []*DetectedProject) []byte {
+	if len(projects) == 0 {
+		projects = []*DetectedProject{{Dir: ".", Stack: DefaultStack}}
+	}
+
+	root := newFmtMap()
+	if len(projects) == 1 {
+		project := projects[0]
+		root.entries = append(root.entries,
+			&fmtEntry{key: "box", node: newFmtScalar(project.Box())},
+			&fmtEntry{key: "build", node: projectPipeline(project, "build", false)},
+		)
+		return writeFmtDocument(root, false)
+	}
+
+	root.entries = append(root.entries, &fmtEntry{key: "build", node: newFmtMap(
+		&fmtEntry{key: "box", node: newFmtScalar(stackBox(DefaultStack))},
+		&fmtEntry{key: "steps", node: newFmtSeq(scriptStep("copy source", "", `cp -R . "$WERCKER_OUTPUT_DIR"`))},
+	)})
+	workflowPipelines := newFmtSeq(newFmtMap(&fmtEntry{key: "name", node: newFmtScalar("build")}))
+
+	names := projectPipelineNames(projects)
+	for i, project := range projects {
+		root.entries = append(root.entries, &fmtEntry{key: names[i], node: projectPipeline(project, names[i], true)})
+		workflowPipelines.items = append(workflowPipelines.items, newFmtMap(
+			&fmtEntry{key: "name", node: newFmtScalar(names[i])},
+			&fmtEntry{key: "requires", node: newFmtSeq(newFmtScalar("build"))},
+		))
+	}
+	root.entries = append(root.entries, &fmtEntry{key: "workflows", node: newFmtSeq(newFmtMap(
+		&fmtEntry{key: "name", node: newFmtScalar("build")},
+		&fmtEntry{key: "pipelines", node: workflowPipelines},
+	))})
+	return writeFmtDocument(root, true)
+}
+
+// projectPipelineNames names the pipelines of projects after their
+// directories, adding the stack when a directory has more than one
+func projectPipelineNames(projects []*DetectedProject) []string {
+	perDir := map[string]int{}
+	for _, project := range projects {
+		perDir[project.Dir]++
+	}
+	invalid := regexp.MustCompile(`[^a-z0-9]+`)
+	names := []string{}
+	for _, project := range projects {
+		name := strings.Trim(invalid.ReplaceAllString(strings.ToLower(project.Dir), "-"), "-")
+		switch {
+		case name == "":
+			name = project.Stack
+		case perDir[project.Dir] > 1 || name == "build":
+			name = fmt.Sprintf("%s-%s", name, project.Stack)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func projectPipeline(project *DetectedProject, name string, withBox bool) *fmtNode {
+	pipeline := newFmtMap()
+	if withBox {
+		pipeline.entries = append(pipeline.entries, &fmtEntry{key: "box", node: newFmtScalar(project.Box())})
+	}
+	if len(project.Services) > 0 {
+		services := newFmtSeq()
+		for _, service := range project.Services {
+			if len(service.Env) == 0 {
+				services.items = append(services.items, newFmtScalar(service.ID))
+				continue
+			}
+			keys := []string{}
+			for key := range service.Env {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			env := newFmtMap()
+			for _, key := range keys {
+				env.entries = append(env.entries, &fmtEntry{key: key, node: newFmtScalar(service.Env[key])})
+			}
+			services.items = append(services.items, newFmtMap(
+				&fmtEntry{key: "id", node: newFmtScalar(service.ID)},
+				&fmtEntry{key: "env", node: env},
+			))
+		}
+		pipeline.entries = append(pipeline.entries, &fmtEntry{key: "services", node: services})
+	}
+
+	cwd := ""
+	if project.Dir != "." {
+		cwd = project.Dir
+	}
+	steps := newFmtSeq()
+	if project.Stack == "docker" {
+		steps.items = append(steps.items, newFmtMap(&fmtEntry{key: "internal/docker-build", node: newFmtMap(
+			&fmtEntry{key: "dockerfile", node: newFmtScalar(filepath.ToSlash(filepath.Join(project.Dir, "Dockerfile")))},
+			&fmtEntry{key: "image-name", node: newFmtScalar(name)},
+		)}))
+	}
+	for _, step := range defaultStacks[project.Stack].steps {
+		steps.items = append(steps.items, scriptStep(step[0], cwd, step[1]))
+	}
+	pipeline.entries = append(pipeline.entries, &fmtEntry{key: "steps", node: steps})
+	return pipeline
+}
+
+func scriptStep(name, cwd, code string) *fmtNode {
+	data := newFmtMap(&fmtEntry{key: "name", node: newFmtScalar(name)})
+	if cwd != "" {
+		data.entries = append(data.entries, &fmtEntry{key: "cwd", node: newFmtScalar(cwd)})
+	}
+	data.entries = append(data.entries, &fmtEntry{key: "code", node: newFmtScalar(code)})
+	return newFmtMap(&fmtEntry{key: "script", node: data})
+}
+
+// writeFmtDocument writes the top level entries of root, separated by a blank
+// line when separate is set
+func writeFmtDocument(root *fmtNode, separate bool) []byte {
+	var b bytes.Buffer
+	for i, entry := range root.entries {
+		if i > 0 && separate {
+			b.WriteString("\n")
+		}
+		root.writeEntry(&b, entry, 0)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,220 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type DetectSuite struct {
+	*util.TestSuite
+}
+
+func TestDetectSuite(t *testing.T) {
+	suiteTester := &DetectSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *DetectSuite) TestDetectStack() {
+	tests := []struct {
+		files    []string
+		expected string
+	}{
+		{[]string{"package.json", "README.md"}, "nodejs"},
+		{[]string{"main.go"}, "golang"},
+		{[]string{"build.gradle"}, "java-gradle"},
+		{[]string{"README.md"}, DefaultStack},
+	}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "wercker-detect-")
+		s.Require().Nil(err)
+		defer os.RemoveAll(dir)
+		for _, name := range test.files {
+			s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644))
+		}
+
+		stack, err := DetectStack(dir)
+		s.Require().Nil(err)
+		s.Equal(test.expected, stack)
+	}
+}
+
+func (s *DetectSuite) TestDefaultConfigYaml() {
+	for stack, defaults := range defaultStacks {
+		config, err := ConfigFromYaml(DefaultConfigYaml(stack))
+		s.Require().Nil(err)
+		s.Equal(defaults.box, config.Box.ID)
+		steps := len(defaults.steps)
+		if stack == "docker" {
+			// docker projects are built with internal/docker-build
+			steps = 1
+		}
+		s.Len(config.PipelinesMap["build"].Steps, steps)
+	}
+
+	s.Equal(`box: golang
+build:
+  steps:
+    - script:
+        name: install dependencies
+        code: go get -t -v ./...
+    - script:
+        name: build
+        code: go build ./...
+    - script:
+        name: test
+        code: go test ./...
+`, string(DefaultConfigYaml("golang")))
+}
+
+func (s *DetectSuite) TestReadWerckerYamlDefault() {
+	dir, err := ioutil.TempDir("", "wercker-detect-")
+	s.Require().Nil(err)
+	defer os.RemoveAll(dir)
+	s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, "Gemfile"), []byte{}, 0644))
+
+	_, _, err = ReadWerckerYaml([]string{dir}, false)
+	s.NotNil(err)
+
+	yamlFile, werckerYaml, err := ReadWerckerYaml([]string{dir}, true)
+	s.Require().Nil(err)
+	s.Equal(filepath.Join(dir, "wercker.yml"), yamlFile)
+	s.Equal(string(DefaultConfigYaml("ruby")), string(werckerYaml))
+
+	s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, ".wercker.yml"), []byte("box: ruby\n"), 0644))
+	yamlFile, werckerYaml, err = ReadWerckerYaml([]string{dir}, true)
+	s.Require().Nil(err)
+	s.Equal(filepath.Join(dir, ".wercker.yml"), yamlFile)
+	s.Equal("box: ruby\n", string(werckerYaml))
+}
+
+func (s *DetectSuite) TestDetectProjects() {
+	dir, err := ioutil.TempDir("", "wercker-detect-")
+	s.Require().Nil(err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"README.md":                       "",
+		"docker-compose.yml":              "services:\n  db:\n    image: postgres:10\n",
+		"api/go.mod":                      "module example.com/api\n\ngo 1.11\n\nrequire github.com/go-redis/redis v6.15.0\n",
+		"api/main.go":                     "",
+		"api/internal/handlers/x.go":      "",
+		"web/package.json":                `{"dependencies": {"pg": "^7.0.0"}}`,
+		"web/.nvmrc":                      "v10.15.3\n",
+		"web/node_modules/x/package.json": "",
+		"tools/rust/Cargo.toml":           "[dependencies]\n",
+		"tools/rust/.tool-versions":       "rust 1.31.1\n",
+		"infra/Dockerfile":                "",
+		".hidden/Gemfile":                 "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		s.Require().Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().Nil(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	projects, err := DetectProjects(dir)
+	s.Require().Nil(err)
+	detected := map[string]*DetectedProject{}
+	for _, project := range projects {
+		detected[project.Dir] = project
+	}
+	s.Len(detected, 4)
+
+	s.Equal("golang", detected["api"].Stack)
+	s.Equal("golang:1.11", detected["api"].Box())
+	s.Require().Len(detected["api"].Services, 1)
+	s.Equal("redis", detected["api"].Services[0].ID)
+
+	s.Equal("nodejs", detected["web"].Stack)
+	s.Equal("node:10", detected["web"].Box())
+	s.Require().Len(detected["web"].Services, 1)
+	s.Equal("postgres", detected["web"].Services[0].ID)
+	s.Equal("postgres", detected["web"].Services[0].Env["POSTGRES_PASSWORD"])
+
+	s.Equal("rust:1.31", detected["tools/rust"].Box())
+	s.Equal("docker", detected["infra"].Stack)
+
+	config, err := ConfigFromYaml(GenerateConfigYaml(projects))
+	s.Require().Nil(err)
+	s.Contains(config.PipelinesMap, "build")
+	s.Contains(config.PipelinesMap, "tools-rust")
+	s.Equal("golang:1.11", config.PipelinesMap["api"].Box.ID)
+	s.Equal("api", config.PipelinesMap["api"].Steps[0].Cwd)
+	s.Require().Len(config.Workflows, 1)
+	s.Len(config.Workflows[0].Pipelines, 5)
+	s.Nil(config.Workflows[0].Validate(config))
+}
+
+func (s *DetectSuite) TestReadWerckerYamlDefaultProjects() {
+	dir, err := ioutil.TempDir("", "wercker-detect-")
+	s.Require().Nil(err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"api/go.mod":       "module example.com/api\n",
+		"web/package.json": "{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		s.Require().Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().Nil(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	_, werckerYaml, err := ReadWerckerYaml([]string{dir}, true)
+	s.Require().Nil(err)
+	config, err := ConfigFromYaml(werckerYaml)
+	s.Require().Nil(err)
+	s.Equal("golang", config.Box.ID)
+	s.Len(config.PipelinesMap, 1)
+	s.Len(config.Workflows, 0)
+	s.Equal("api", config.PipelinesMap["build"].Steps[0].Cwd)
+}
+
+func (s *DetectSuite) TestDetectProjectsRoot() {
+	dir, err := ioutil.TempDir("", "wercker-detect-")
+	s.Require().Nil(err)
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"Makefile":           "",
+		"main.go":            "",
+		"cmd/tool/main.go":   "",
+		"docker-compose.yml": "services:\n  cache:\n    image: library/redis:5\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		s.Require().Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().Nil(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	projects, err := DetectProjects(dir)
+	s.Require().Nil(err)
+	s.Require().Len(projects, 1)
+	s.Equal(".", projects[0].Dir)
+	s.Equal("golang", projects[0].Stack)
+	s.Require().Len(projects[0].Services, 1)
+	s.Equal("library/redis:5", projects[0].Services[0].ID)
+
+	config, err := ConfigFromYaml(GenerateConfigYaml(projects))
+	s.Require().Nil(err)
+	s.Equal("golang", config.Box.ID)
+	s.Len(config.PipelinesMap["build"].Services, 1)
+	s.Len(config.Workflows, 0)
+}
@@ -93,6 +93,8 @@ type BuildStepStartedArgs struct {
 	Build   Pipeline
 	Order   int
 	Step    Step
+	// Group is the parallel group the step runs in, if any
+	Group Step
 }
 
 // BuildStepFinishedArgs contains the args associated with the
@@ -104,8 +106,14 @@ type BuildStepFinishedArgs struct {
 	Order       int
 	Step        Step
 	Successful  bool
+	Skipped     bool
 	Message     string
 	ArtifactURL string
+	// Attempts is how many times the step ran, more than one if it was retried
+	Attempts int
+	ExitCode int
+	// Group is the parallel group the step runs in, if any
+	Group Step
 	// Only applicable to the store step
 	PackageURL string
 	// Only applicable to the setup environment step
@@ -231,8 +239,12 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 		if a.Build == nil {
 			a.Build = e.build
 		}
-		e.currentStep = a.Step
-		e.currentOrder = a.Order
+		// The steps of a parallel group run at the same time, the group
+		// stays the current step
+		if a.Group == nil {
+			e.currentStep = a.Step
+			e.currentOrder = a.Order
+		}
 		e.Emitter.Emit(event, a)
 	// Add options, build, step, order, default stream
 	case Logs:
@@ -269,8 +281,10 @@ func (e *NormalizedEmitter) Emit(event interface{}, args interface{}) {
 			a.Order = e.currentOrder
 		}
 		e.Emitter.Emit(event, a)
-		e.currentStep = nil
-		e.currentOrder = -1
+		if a.Group == nil {
+			e.currentStep = nil
+			e.currentOrder = -1
+		}
 	// Just add the options
 	case BuildFinished:
 		a := args.(*BuildFinishedArgs)
@@ -0,0 +1,56 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type EventsSuite struct {
+	*util.TestSuite
+}
+
+func TestEventsSuite(t *testing.T) {
+	suiteTester := &EventsSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *EventsSuite) TestNormalizedEmitterParallelSteps() {
+	e := NewNormalizedEmitter()
+	logs := []*LogsArgs{}
+	finished := []*BuildStepFinishedArgs{}
+	e.AddListener(Logs, func(args *LogsArgs) { logs = append(logs, args) })
+	e.AddListener(BuildStepFinished, func(args *BuildStepFinishedArgs) { finished = append(finished, args) })
+
+	group := NewParallelStep(&StepConfig{ID: "parallel"}, nil)
+	child := NewParallelStep(&StepConfig{ID: "parallel"}, nil)
+
+	e.Emit(BuildStepStarted, &BuildStepStartedArgs{Step: group, Order: 4})
+	e.Emit(BuildStepStarted, &BuildStepStartedArgs{Step: child, Group: group, Order: 4})
+	e.Emit(BuildStepFinished, &BuildStepFinishedArgs{Step: child, Group: group, Order: 4})
+	e.Emit(Logs, &LogsArgs{Logs: "after the child"})
+	e.Emit(BuildStepFinished, &BuildStepFinishedArgs{})
+
+	// The group stays the current step while its steps run
+	s.Require().Len(logs, 1)
+	s.Equal(group, logs[0].Step)
+	s.Equal(4, logs[0].Order)
+	s.Require().Len(finished, 2)
+	s.Equal(child, finished[0].Step)
+	s.Equal(group, finished[1].Step)
+}
@@ -0,0 +1,104 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WorkflowFiltersConfig limits when a pipeline of a workflow runs. Both lists
+// hold patterns like "release/*", where "**" matches any number of
+// directories and a trailing "/" matches everything below a directory.
+type WorkflowFiltersConfig struct {
+	// Branches the pipeline runs on
+	Branches []string `yaml:"branches"`
+	// Paths of which at least one has to change for the pipeline to run
+	Paths []string `yaml:"paths"`
+}
+
+// Validate checks that every pattern can be matched
+func (f *WorkflowFiltersConfig) Validate() error {
+	for _, pattern := range append(f.Branches, f.Paths...) {
+		if _, err := path.Match(strings.Replace(pattern, "**", "*", -1), ""); err != nil {
+			return errors.Errorf("invalid filter %q", pattern)
+		}
+	}
+	return nil
+}
+
+// MatchesBranch is true when branch matches one of the branch filters. An
+// unknown branch matches, so is a missing filter.
+func (f *WorkflowFiltersConfig) MatchesBranch(branch string) bool {
+	if f == nil || len(f.Branches) == 0 || branch == "" {
+		return true
+	}
+	for _, pattern := range f.Branches {
+		if MatchFilter(pattern, branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesPaths is true when one of the changed files matches one of the path
+// filters. When the changed files are not known, changed is nil and the
+// filters match.
+func (f *WorkflowFiltersConfig) MatchesPaths(changed []string) bool {
+	if f == nil || len(f.Paths) == 0 || changed == nil {
+		return true
+	}
+	for _, file := range changed {
+		for _, pattern := range f.Paths {
+			if MatchFilter(pattern, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchFilter tells whether name, a branch or a slash separated path, matches
+// a filter pattern.
+func MatchFilter(pattern, name string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try every number of segments for the "**", none included
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,83 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type FiltersSuite struct {
+	*util.TestSuite
+}
+
+func TestFiltersSuite(t *testing.T) {
+	suiteTester := &FiltersSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *FiltersSuite) TestMatchFilter() {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"master", "master", true},
+		{"master", "main", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", false},
+		{"release/**", "release/1.0/hotfix", true},
+		{"services/api/", "services/api/main.go", true},
+		{"services/api/", "services/api/handlers/users.go", true},
+		{"services/api/", "services/web/main.go", false},
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "cmd/main.go", true},
+		{"**/*.go", "main.go", true},
+		{"docs/**/*.md", "docs/guide/install.md", true},
+		{"docs/**/*.md", "docs/install.md", true},
+		{"docs/**/*.md", "README.md", false},
+	}
+
+	for _, test := range tests {
+		s.Equal(test.expected, MatchFilter(test.pattern, test.name), "%s matching %s", test.pattern, test.name)
+	}
+}
+
+func (s *FiltersSuite) TestWorkflowFilters() {
+	filters := &WorkflowFiltersConfig{
+		Branches: []string{"master", "release/*"},
+		Paths:    []string{"services/api/", "go.mod"},
+	}
+
+	s.True(filters.MatchesBranch("master"))
+	s.True(filters.MatchesBranch("release/2.0"))
+	s.False(filters.MatchesBranch("feature/login"))
+	s.True(filters.MatchesBranch(""))
+
+	s.True(filters.MatchesPaths([]string{"README.md", "go.mod"}))
+	s.False(filters.MatchesPaths([]string{"services/web/main.go"}))
+	s.False(filters.MatchesPaths([]string{}))
+	s.True(filters.MatchesPaths(nil))
+
+	var none *WorkflowFiltersConfig
+	s.True(none.MatchesBranch("feature/login"))
+	s.True(none.MatchesPaths([]string{}))
+
+	s.Nil(filters.Validate())
+	s.NotNil((&WorkflowFiltersConfig{Paths: []string{"services/[api"}}).Validate())
+}
@@ -0,0 +1,519 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FormatConfig rewrites a wercker.yml in its canonical form. The deprecated
+// shapes that are still accepted when parsing are migrated:
+//
+//	steps written as a map with the step id as the first key are nested
+//	under the step id
+//	continue-on-error becomes allow-failure
+//	deploy targets become pipelines that extend their pipeline, and a
+//	workflow that runs them
+//	trailing slashes are removed from base-path
+//
+// Everything else is kept in the order it was written in. Full line
+// comments are kept above the node they were written above, comments at the
+// end of a line are dropped. Files listed under include are read relative to
+// filename, but are not formatted themselves.
+func FormatConfig(filename string, src []byte) ([]byte, error) {
+	before, err := ConfigFromYamlFile(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw RawConfig
+	if err := yaml.Unmarshal(src, &raw); err != nil {
+		return nil, err
+	}
+	// Scalars are written back as they were written, yaml would turn a tag
+	// like 1.10 into 1.1 otherwise
+	var doc *yamlValue
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, err
+	}
+	if _, ok := doc.plain().(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("Your wercker.yml is not a map")
+	}
+
+	_, comments := scanYaml(src)
+	root := newFmtNode(doc, nil, comments)
+	trailing := root.comments
+	root.comments = nil
+
+	f := &configFormatter{root: root, config: raw.Config}
+	if err := f.migrate(); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	for i, entry := range root.entries {
+		// Top level sections are separated by a blank line
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		root.writeEntry(&b, entry, 0)
+	}
+	if len(trailing) > 0 {
+		b.WriteString("\n")
+		writeFmtComments(&b, trailing, 0)
+	}
+
+	// The result has to mean the same thing as what we started with
+	after, err := ConfigFromYamlFile(filename, b.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "formatted wercker.yml is invalid")
+	}
+	if err := sameConfig(before, after); err != nil {
+		return nil, errors.Wrap(err, "formatting changed the wercker.yml")
+	}
+	return b.Bytes(), nil
+}
+
+// sameConfig checks that after means the same as before, apart from the
+// deploy targets of before that were moved to pipelines of their own
+func sameConfig(before, after *Config) error {
+	b, a := *before, *after
+	b.PipelinesMap, a.PipelinesMap = nil, nil
+	b.Templates, a.Templates = nil, nil
+	b.Workflows, a.Workflows = nil, nil
+	b.PipelineSources, a.PipelineSources = nil, nil
+	if !reflect.DeepEqual(b, a) {
+		return errors.New("the top level settings changed")
+	}
+
+	if err := samePipelines("pipeline", before.PipelinesMap, after.PipelinesMap); err != nil {
+		return err
+	}
+	if err := samePipelines("template", before.Templates, after.Templates); err != nil {
+		return err
+	}
+
+	// Workflows for the deploy targets are added after the existing ones
+	if len(after.Workflows) < len(before.Workflows) {
+		return errors.New("the workflows changed")
+	}
+	for i, workflow := range before.Workflows {
+		if !reflect.DeepEqual(workflow, after.Workflows[i]) {
+			return errors.Errorf("workflow %s changed", workflow.Name)
+		}
+	}
+	return nil
+}
+
+func samePipelines(kind string, before, after map[string]*RawPipelineConfig) error {
+	names := []string{}
+	for name := range before {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pipeline := before[name]
+		formatted, ok := after[name]
+		if !ok {
+			return errors.Errorf("%s %s is missing", kind, name)
+		}
+		if pipeline == nil || pipeline.PipelineConfig == nil || formatted == nil || formatted.PipelineConfig == nil {
+			if !reflect.DeepEqual(pipeline, formatted) {
+				return errors.Errorf("%s %s changed", kind, name)
+			}
+			continue
+		}
+
+		p, f := *pipeline.PipelineConfig, *formatted.PipelineConfig
+		for target, steps := range p.StepsMap {
+			moved, ok := after[fmt.Sprintf("%s-%s", name, target)]
+			if !ok || moved == nil || moved.PipelineConfig == nil {
+				// An inherited deploy target, it moved with its pipeline
+				continue
+			}
+			if !reflect.DeepEqual(RawStepsConfig(steps), moved.Steps) {
+				return errors.Errorf("the steps of deploy target %s of %s changed", target, name)
+			}
+		}
+		p.StepsMap, f.StepsMap = nil, nil
+		if !reflect.DeepEqual(p, f) {
+			return errors.Errorf("%s %s changed", kind, name)
+		}
+	}
+	return nil
+}
+
+type fmtKind int
+
+const (
+	fmtScalar fmtKind = iota
+	fmtMap
+	fmtSeq
+)
+
+// fmtNode is a yaml value together with the comments written above it
+type fmtNode struct {
+	kind     fmtKind
+	comments []string
+	value    interface{}
+	// text is the scalar as it was written
+	text    string
+	entries []*fmtEntry
+	items   []*fmtNode
+}
+
+// fmtEntry is a key and its value in a yaml map
+type fmtEntry struct {
+	key  string
+	node *fmtNode
+}
+
+func newFmtNode(value *yamlValue, path yamlPath, comments yamlComments) *fmtNode {
+	n := &fmtNode{comments: comments[path.key()]}
+	if value == nil {
+		return n
+	}
+	switch value.value.(type) {
+	case map[interface{}]interface{}:
+		n.kind = fmtMap
+		for _, item := range value.entries {
+			n.entries = append(n.entries, &fmtEntry{
+				key:  item.Key,
+				node: newFmtNode(item.Value, path.child(item.Key), comments),
+			})
+		}
+	case []interface{}:
+		n.kind = fmtSeq
+		for i, item := range value.items {
+			n.items = append(n.items, newFmtNode(item, path.item(i), comments))
+		}
+	default:
+		n.value = value.value
+		n.text = value.text
+	}
+	return n
+}
+
+func newFmtMap(entries ...*fmtEntry) *fmtNode {
+	return &fmtNode{kind: fmtMap, entries: entries}
+}
+
+func newFmtSeq(items ...*fmtNode) *fmtNode {
+	return &fmtNode{kind: fmtSeq, items: items}
+}
+
+func newFmtScalar(value string) *fmtNode {
+	return &fmtNode{kind: fmtScalar, value: value, text: value}
+}
+
+// get returns the entry for key in a map node
+func (n *fmtNode) get(key string) *fmtEntry {
+	for _, entry := range n.entries {
+		if entry.key == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// configFormatter migrates the deprecated shapes in a wercker.yml
+type configFormatter struct {
+	root   *fmtNode
+	config *Config
+}
+
+func (f *configFormatter) migrate() error {
+	entries := []*fmtEntry{}
+	workflows := []*fmtNode{}
+	for _, entry := range f.root.entries {
+		entries = append(entries, entry)
+		if entry.key == "templates" && entry.node.kind == fmtMap {
+			for _, template := range entry.node.entries {
+				if template.node.kind == fmtMap {
+					f.migratePipeline(template.node)
+				}
+			}
+			continue
+		}
+		if _, ok := configReservedWords[entry.key]; ok || entry.node.kind != fmtMap {
+			continue
+		}
+
+		targets := f.migratePipeline(entry.node)
+		if len(targets) == 0 {
+			continue
+		}
+		pipelines, targetWorkflows, err := f.targetPipelines(entry, targets)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, pipelines...)
+		workflows = append(workflows, targetWorkflows...)
+	}
+	f.root.entries = entries
+
+	if len(workflows) > 0 {
+		section := f.root.get("workflows")
+		if section == nil {
+			section = &fmtEntry{key: "workflows", node: newFmtSeq()}
+			f.root.entries = append(f.root.entries, section)
+		}
+		if section.node.kind != fmtSeq {
+			return fmt.Errorf("workflows is not a list")
+		}
+		section.node.items = append(section.node.items, workflows...)
+	}
+	return nil
+}
+
+// migratePipeline migrates a pipeline in place and returns its deploy
+// targets, which are removed from it
+func (f *configFormatter) migratePipeline(pipeline *fmtNode) []*fmtEntry {
+	entries := []*fmtEntry{}
+	targets := []*fmtEntry{}
+	for _, entry := range pipeline.entries {
+		switch entry.key {
+		case "steps", "after-steps", "on-success", "on-failure", "always":
+			f.migrateSteps(entry.node)
+		case "base-path":
+			if basePath, ok := entry.node.value.(string); ok {
+				entry.node.value = strings.TrimSuffix(basePath, "/")
+			}
+		default:
+			if _, ok := pipelineReservedWords[entry.key]; !ok && entry.node.kind == fmtSeq {
+				f.migrateSteps(entry.node)
+				targets = append(targets, entry)
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+	pipeline.entries = entries
+	return targets
+}
+
+func (f *configFormatter) migrateSteps(steps *fmtNode) {
+	for _, step := range steps.items {
+		if step.kind != fmtMap || len(step.entries) == 0 {
+			continue
+		}
+
+		// The deprecated form has the step id as the first key and the
+		// step's properties next to it
+		if len(step.entries) > 1 {
+			id := step.entries[0]
+			step.entries = []*fmtEntry{{key: id.key, node: newFmtMap(step.entries[1:]...)}}
+		}
+
+		entry := step.entries[0]
+		if entry.key == "parallel" {
+			if entry.node.kind == fmtSeq {
+				f.migrateSteps(entry.node)
+			}
+			continue
+		}
+		if entry.node.kind == fmtMap && entry.node.get("allow-failure") == nil {
+			if old := entry.node.get("continue-on-error"); old != nil {
+				old.key = "allow-failure"
+			}
+		}
+	}
+}
+
+// targetPipelines turns the deploy targets of a pipeline into pipelines that
+// extend it, with a workflow that runs them after the build pipeline, or one
+// workflow per target when there is no build pipeline
+func (f *configFormatter) targetPipelines(pipeline *fmtEntry, targets []*fmtEntry) ([]*fmtEntry, []*fmtNode, error) {
+	_, hasBuild := f.config.PipelinesMap["build"]
+	hasSteps := pipeline.node.get("steps") != nil
+
+	entries := []*fmtEntry{}
+	workflowPipelines := []*fmtNode{}
+	workflows := []*fmtNode{}
+	if hasBuild {
+		workflowPipelines = append(workflowPipelines, newFmtMap(
+			&fmtEntry{key: "name", node: newFmtScalar("build")},
+		))
+	}
+
+	for _, target := range targets {
+		name := fmt.Sprintf("%s-%s", pipeline.key, target.key)
+		if f.root.get(name) != nil {
+			return nil, nil, fmt.Errorf("Cannot move deploy target %s of %s to pipeline %s, it already exists", target.key, pipeline.key, name)
+		}
+		if f.config.GetWorkflow(name) != nil && !hasBuild {
+			return nil, nil, fmt.Errorf("Cannot add workflow %s for deploy target %s of %s, it already exists", name, target.key, pipeline.key)
+		}
+
+		node := newFmtMap(&fmtEntry{key: "extends", node: newFmtScalar(pipeline.key)})
+		node.comments = target.node.comments
+		target.node.comments = nil
+		if hasSteps {
+			node.entries = append(node.entries, &fmtEntry{key: "merge", node: newFmtMap(
+				&fmtEntry{key: "steps", node: newFmtScalar(MergeReplace)},
+			)})
+		}
+		node.entries = append(node.entries,
+			&fmtEntry{key: "env", node: newFmtMap(
+				&fmtEntry{key: "WERCKER_DEPLOYTARGET_NAME", node: newFmtScalar(target.key)},
+			)},
+			&fmtEntry{key: "steps", node: target.node},
+		)
+		entries = append(entries, &fmtEntry{key: name, node: node})
+
+		if hasBuild {
+			workflowPipelines = append(workflowPipelines, newFmtMap(
+				&fmtEntry{key: "name", node: newFmtScalar(name)},
+				&fmtEntry{key: "requires", node: newFmtSeq(newFmtScalar("build"))},
+			))
+			continue
+		}
+		workflows = append(workflows, newFmtMap(
+			&fmtEntry{key: "name", node: newFmtScalar(name)},
+			&fmtEntry{key: "pipelines", node: newFmtSeq(newFmtMap(
+				&fmtEntry{key: "name", node: newFmtScalar(name)},
+			))},
+		))
+	}
+
+	if hasBuild {
+		if f.config.GetWorkflow(pipeline.key) != nil {
+			return nil, nil, fmt.Errorf("Cannot add workflow %s for the deploy targets of %s, it already exists", pipeline.key, pipeline.key)
+		}
+		workflows = append(workflows, newFmtMap(
+			&fmtEntry{key: "name", node: newFmtScalar(pipeline.key)},
+			&fmtEntry{key: "pipelines", node: newFmtSeq(workflowPipelines...)},
+		))
+	}
+	return entries, workflows, nil
+}
+
+// writeEntry writes "key: value" for an entry of a map at indent
+func (n *fmtNode) writeEntry(b *bytes.Buffer, entry *fmtEntry, indent int) {
+	writeFmtComments(b, entry.node.comments, indent)
+	b.WriteString(strings.Repeat(" ", indent))
+	b.WriteString(fmtString(entry.key))
+	b.WriteString(":")
+	entry.node.writeValue(b, indent)
+}
+
+// writeValue writes the value that follows a key or a sequence dash, indent
+// is the indentation of that key or dash
+func (n *fmtNode) writeValue(b *bytes.Buffer, indent int) {
+	switch {
+	case n.kind == fmtMap && len(n.entries) == 0:
+		b.WriteString(" {}\n")
+	case n.kind == fmtMap:
+		b.WriteString("\n")
+		for _, entry := range n.entries {
+			n.writeEntry(b, entry, indent+2)
+		}
+	case n.kind == fmtSeq && len(n.items) == 0:
+		b.WriteString(" []\n")
+	case n.kind == fmtSeq:
+		b.WriteString("\n")
+		n.writeItems(b, indent+2)
+	default:
+		writeFmtScalar(b, n, indent+2)
+	}
+}
+
+// writeItems writes the items of a sequence at indent
+func (n *fmtNode) writeItems(b *bytes.Buffer, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, item := range n.items {
+		writeFmtComments(b, item.comments, indent)
+		if item.kind != fmtMap || len(item.entries) == 0 {
+			b.WriteString(pad + "-")
+			item.writeValue(b, indent)
+			continue
+		}
+
+		// A map starts on the line of its dash
+		first := item.entries[0]
+		writeFmtComments(b, first.node.comments, indent)
+		b.WriteString(pad + "- " + fmtString(first.key) + ":")
+		first.node.writeValue(b, indent+2)
+		for _, entry := range item.entries[1:] {
+			item.writeEntry(b, entry, indent+2)
+		}
+	}
+}
+
+func writeFmtComments(b *bytes.Buffer, comments []string, indent int) {
+	for _, comment := range comments {
+		b.WriteString(strings.Repeat(" ", indent) + comment + "\n")
+	}
+}
+
+// writeFmtScalar writes a scalar after a key or dash, multi line strings are
+// written as literal blocks indented to indent. Strings a literal block can
+// not represent without an indentation indicator or keep chomping are quoted,
+// other scalars are written as they were.
+func writeFmtScalar(b *bytes.Buffer, n *fmtNode, indent int) {
+	s, ok := n.value.(string)
+	if !ok {
+		if n.value != nil {
+			b.WriteString(" " + n.text)
+		}
+		b.WriteString("\n")
+		return
+	}
+	if !strings.Contains(s, "\n") || strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\t") || strings.HasSuffix(s, "\n\n") {
+		b.WriteString(" " + fmtString(s) + "\n")
+		return
+	}
+
+	header := "|-"
+	if strings.HasSuffix(s, "\n") {
+		header = "|"
+	}
+	b.WriteString(" " + header + "\n")
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if line != "" {
+			b.WriteString(strings.Repeat(" ", indent) + line)
+		}
+		b.WriteString("\n")
+	}
+}
+
+// fmtString writes s as a plain scalar when yaml reads it back as the same
+// string, and double quoted otherwise
+func fmtString(s string) string {
+	plain := s != "" &&
+		s == strings.TrimSpace(s) &&
+		!strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") &&
+		!strings.ContainsAny(s, "\n\r\t") &&
+		!strings.Contains(s, ": ") &&
+		!strings.Contains(s, " #") &&
+		!strings.HasSuffix(s, ":")
+	if plain {
+		var v interface{}
+		err := yaml.Unmarshal([]byte(s), &v)
+		if read, ok := v.(string); err == nil && ok && read == s {
+			return s
+		}
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,229 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type FormatSuite struct {
+	*util.TestSuite
+}
+
+func TestFormatSuite(t *testing.T) {
+	suiteTester := &FormatSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *FormatSuite) TestFormatConfig() {
+	formatted, err := FormatConfig("wercker.yml", []byte(`# the box
+box: golang
+build:
+  # go stuff
+  steps:
+  - script:
+    name: test
+    code: |
+      go get ./...
+      go test ./...
+    continue-on-error: true
+  - parallel:
+    - script:
+      name: lint
+      code: make lint
+deploy:
+  base-path: src/app/
+  steps:
+    - script:
+        code: make
+  # the real thing
+  production:
+    - script:
+        code: make deploy
+# bye
+`))
+	s.Require().Nil(err)
+	s.Equal(`# the box
+box: golang
+
+build:
+  # go stuff
+  steps:
+    - script:
+        name: test
+        code: |
+          go get ./...
+          go test ./...
+        allow-failure: true
+    - parallel:
+        - script:
+            name: lint
+            code: make lint
+
+deploy:
+  base-path: src/app
+  steps:
+    - script:
+        code: make
+
+# the real thing
+deploy-production:
+  extends: deploy
+  merge:
+    steps: replace
+  env:
+    WERCKER_DEPLOYTARGET_NAME: production
+  steps:
+    - script:
+        code: make deploy
+
+workflows:
+  - name: deploy
+    pipelines:
+      - name: build
+      - name: deploy-production
+        requires:
+          - build
+
+# bye
+`, string(formatted))
+
+	again, err := FormatConfig("wercker.yml", formatted)
+	s.Require().Nil(err)
+	s.Equal(string(formatted), string(again))
+}
+
+func (s *FormatSuite) TestFormatConfigScalars() {
+	formatted, err := FormatConfig("wercker.yml", []byte(`
+box:
+  id: golang
+  tag: 1.10
+build:
+  steps:
+    - script:
+        code: "true"
+        flag: true
+        version: 1.0
+        go-version: 1.20
+        count: 3
+        message: "hello: world"
+        quoted: echo "hi"
+        empty: ""
+        trailing: "two\n\n"
+`))
+	s.Require().Nil(err)
+	s.Equal(`box:
+  id: golang
+  tag: 1.10
+
+build:
+  steps:
+    - script:
+        code: "true"
+        flag: true
+        version: 1.0
+        go-version: 1.20
+        count: 3
+        message: "hello: world"
+        quoted: echo "hi"
+        empty: ""
+        trailing: "two\n\n"
+`, string(formatted))
+}
+
+func (s *FormatSuite) TestFormatConfigWithInclude() {
+	dir := s.WorkingDir()
+	s.Require().Nil(ioutil.WriteFile(filepath.Join(dir, "templates.yml"), []byte("templates:\n  base:\n    box: alpine\n"), 0644))
+
+	formatted, err := FormatConfig(filepath.Join(dir, "wercker.yml"), []byte(`
+include: templates.yml
+build:
+  extends: base
+  steps:
+  - script:
+    code: make
+`))
+	s.Require().Nil(err)
+	s.Equal(`include: templates.yml
+
+build:
+  extends: base
+  steps:
+    - script:
+        code: make
+`, string(formatted))
+}
+
+func (s *FormatSuite) TestSameConfig() {
+	before, err := ConfigFromYaml([]byte("box:\n  id: golang\n  tag: 1.10\n"))
+	s.Require().Nil(err)
+	after, err := ConfigFromYaml([]byte("box:\n  id: golang\n  tag: 1.1\n"))
+	s.Require().Nil(err)
+	s.NotNil(sameConfig(before, after))
+	s.Nil(sameConfig(before, before))
+
+	before, err = ConfigFromYaml([]byte("build:\n  steps:\n    - script:\n        code: make\n"))
+	s.Require().Nil(err)
+	after, err = ConfigFromYaml([]byte("build:\n  steps:\n    - script:\n        code: make test\n"))
+	s.Require().Nil(err)
+	err = sameConfig(before, after)
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "pipeline build changed")
+}
+
+func (s *FormatSuite) TestFormatConfigTargetsWithoutBuild() {
+	formatted, err := FormatConfig("wercker.yml", []byte(`
+deploy:
+  box: alpine
+  staging:
+    - script:
+        code: make staging
+`))
+	s.Require().Nil(err)
+	s.Equal(`deploy:
+  box: alpine
+
+deploy-staging:
+  extends: deploy
+  env:
+    WERCKER_DEPLOYTARGET_NAME: staging
+  steps:
+    - script:
+        code: make staging
+
+workflows:
+  - name: deploy-staging
+    pipelines:
+      - name: deploy-staging
+`, string(formatted))
+
+	_, err = FormatConfig("wercker.yml", []byte(`
+deploy:
+  staging:
+    - script:
+        code: make staging
+deploy-staging:
+  steps:
+    - script:
+        code: make
+`))
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "it already exists")
+}
@@ -0,0 +1,264 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wercker/wercker/util"
+	"gopkg.in/yaml.v2"
+)
+
+// includeSections are the top level keys, besides pipelines, that an included
+// file may set. Everything else belongs in the main wercker.yml.
+var includeSections = map[string]struct{}{
+	"include":   struct{}{},
+	"services":  struct{}{},
+	"templates": struct{}{},
+	"workflows": struct{}{},
+}
+
+// ConfigFromYamlFile reads the wercker.yml in file like ConfigFromYaml, after
+// merging in the files listed under include. Included paths and globs are
+// relative to the directory of filename, and included files can include
+// other files themselves. PipelineSources of the result records the file
+// each pipeline was defined in.
+func ConfigFromYamlFile(filename string, file []byte) (*Config, error) {
+	r := &includeResolver{
+		sources:   map[string]string{},
+		workflows: map[string]string{},
+		included:  map[string]bool{},
+	}
+	if err := r.include(filename, file); err != nil {
+		return nil, fmt.Errorf("Error parsing your wercker.yml:\n  %s", err.Error())
+	}
+
+	config, err := resolveConfig(&RawConfig{Config: r.config})
+	if err != nil {
+		return nil, err
+	}
+	config.PipelineSources = map[string]string{}
+	for name, pipeline := range config.PipelinesMap {
+		source, ok := r.sources[name]
+		if !ok && pipeline != nil && pipeline.PipelineConfig != nil {
+			source = r.sources[pipeline.MatrixParent]
+		}
+		config.PipelineSources[name] = source
+	}
+	return config, nil
+}
+
+// includeResolver merges a wercker.yml and the files it includes into config.
+// Every file is parsed on its own, so values and the line numbers in errors
+// are the ones of the file they were written in.
+type includeResolver struct {
+	config *Config
+	// sources and workflows map the pipelines, templates and workflows to
+	// the file that defines them, so conflicts can be reported
+	sources   map[string]string
+	workflows map[string]string
+	// stack holds the files being included, to find cycles
+	stack    []string
+	included map[string]bool
+}
+
+func (r *includeResolver) include(filename string, file []byte) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	for i, parent := range r.stack {
+		if parent == abs {
+			cycle := append(r.stack[i:], abs)
+			return fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if r.included[abs] {
+		return nil
+	}
+	r.included[abs] = true
+	r.stack = append(r.stack, abs)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	// The keys and their order come from doc, the values from raw
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(file, &doc); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	var raw RawConfig
+	if err := yaml.Unmarshal(file, &raw); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+
+	main := len(r.stack) == 1
+	if main {
+		r.config = raw.Config
+	}
+	var includes []string
+	for _, item := range doc {
+		if item.Key == "include" {
+			includes, err = includePatterns(filename, item.Value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.merge(filename, item, raw.Config, main); err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range includes {
+		paths, err := includePaths(filename, pattern)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s: %s", filename, err)
+			}
+			if err := r.include(path, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// merge adds the top level item of filename, parsed into config, to the
+// config of the main wercker.yml
+func (r *includeResolver) merge(filename string, item yaml.MapItem, config *Config, main bool) error {
+	_, reserved := configReservedWords[item.Key]
+	if !main && reserved {
+		if _, ok := includeSections[item.Key]; !ok {
+			return fmt.Errorf("%s: %s can only be set in the main wercker.yml", filename, item.Key)
+		}
+	}
+
+	switch item.Key {
+	case "services":
+		if _, ok := item.Value.([]interface{}); !ok {
+			return fmt.Errorf("%s: services is not a list", filename)
+		}
+		if !main {
+			r.config.Services = append(r.config.Services, config.Services...)
+		}
+	case "templates":
+		templates, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return fmt.Errorf("%s: templates is not a map", filename)
+		}
+		for _, template := range templates {
+			if err := r.define("template", "templates."+template.Key, template.Key, filename); err != nil {
+				return err
+			}
+			if !main {
+				if r.config.Templates == nil {
+					r.config.Templates = map[string]*RawPipelineConfig{}
+				}
+				r.config.Templates[template.Key] = config.Templates[template.Key]
+			}
+		}
+	case "workflows":
+		if _, ok := item.Value.([]interface{}); !ok {
+			return fmt.Errorf("%s: workflows is not a list", filename)
+		}
+		for _, workflow := range config.Workflows {
+			if workflow == nil || workflow.Name == "" {
+				continue
+			}
+			if other, ok := r.workflows[workflow.Name]; ok {
+				return fmt.Errorf("workflow %s is defined in both %s and %s", workflow.Name, other, filename)
+			}
+			r.workflows[workflow.Name] = filename
+		}
+		if !main {
+			r.config.Workflows = append(r.config.Workflows, config.Workflows...)
+		}
+	default:
+		if reserved {
+			return nil
+		}
+		if err := r.define("pipeline", item.Key, item.Key, filename); err != nil {
+			return err
+		}
+		if !main {
+			r.config.PipelinesMap[item.Key] = config.PipelinesMap[item.Key]
+		}
+	}
+	return nil
+}
+
+// define records that filename defines the kind called name, failing when
+// another file already did
+func (r *includeResolver) define(kind, key, name, filename string) error {
+	if other, ok := r.sources[key]; ok {
+		return fmt.Errorf("%s %s is defined in both %s and %s", kind, name, other, filename)
+	}
+	r.sources[key] = filename
+	return nil
+}
+
+// includePatterns returns the paths listed under include, which can be a
+// single path or a list of them
+func includePatterns(filename string, value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		patterns := []string{}
+		for _, item := range v {
+			pattern, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: include must be a list of paths", filename)
+			}
+			patterns = append(patterns, pattern)
+		}
+		return patterns, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s: include must be a list of paths", filename)
+}
+
+// includePaths resolves pattern relative to the directory of filename. A
+// glob may match nothing, a plain path has to exist.
+func includePaths(filename, pattern string) ([]string, error) {
+	path := pattern
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(filename), pattern)
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		exists, err := util.Exists(path)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%s: included file %s does not exist", filename, pattern)
+		}
+		return []string{path}, nil
+	}
+	paths, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: include %s: %s", filename, pattern, err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
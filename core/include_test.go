@@ -0,0 +1,175 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type IncludeSuite struct {
+	*util.TestSuite
+}
+
+func TestIncludeSuite(t *testing.T) {
+	suiteTester := &IncludeSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+// writeFiles writes files into the test directory and returns the path of
+// its wercker.yml
+func (s *IncludeSuite) writeFiles(files map[string]string) string {
+	for name, content := range files {
+		path := filepath.Join(s.WorkingDir(), filepath.FromSlash(name))
+		s.Require().Nil(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().Nil(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	return filepath.Join(s.WorkingDir(), "wercker.yml")
+}
+
+func (s *IncludeSuite) load(filename string) (*Config, error) {
+	b, err := ioutil.ReadFile(filename)
+	s.Require().Nil(err)
+	return ConfigFromYamlFile(filename, b)
+}
+
+func (s *IncludeSuite) TestConfigFromYamlFile() {
+	yamlFile := s.writeFiles(map[string]string{
+		"wercker.yml": `
+box: golang
+include:
+  - ci/*.yml
+services:
+  - redis
+build:
+  steps:
+    - script:
+        code: make
+`,
+		"ci/deploy.yml": `
+include: ../shared/templates.yml
+services:
+  - postgres
+deploy:
+  extends: base
+  steps:
+    - script:
+        code: make deploy
+workflows:
+  - name: release
+    pipelines:
+      - name: build
+      - name: deploy
+        requires:
+          - build
+`,
+		"ci/test.yml": `
+test:
+  matrix:
+    tags:
+      - "1.10"
+      - "1.11"
+  steps:
+    - script:
+        code: make test
+`,
+		"shared/templates.yml": `
+templates:
+  base:
+    box: alpine
+`,
+	})
+
+	config, err := s.load(yamlFile)
+	s.Require().Nil(err)
+	s.Equal("golang", config.Box.ID)
+	s.Len(config.Services, 2)
+	s.Equal("alpine", config.PipelinesMap["deploy"].Box.ID)
+	s.Require().Len(config.Workflows, 1)
+	s.Nil(config.Workflows[0].Validate(config))
+
+	s.Equal(yamlFile, config.PipelineSources["build"])
+	s.Equal(filepath.Join(s.WorkingDir(), "ci", "deploy.yml"), config.PipelineSources["deploy"])
+	s.Equal(filepath.Join(s.WorkingDir(), "ci", "test.yml"), config.PipelineSources["test-1"])
+}
+
+func (s *IncludeSuite) TestConfigFromYamlFileKeepsValues() {
+	yamlFile := s.writeFiles(map[string]string{
+		"wercker.yml": "include: a.yml\nbox:\n  id: golang\n  tag: 1.10\n",
+		"a.yml":       "build:\n  steps:\n    - setup-go:\n        go-version: 1.10\n",
+	})
+	config, err := s.load(yamlFile)
+	s.Require().Nil(err)
+	s.Equal("1.10", config.Box.Tag)
+	s.Equal("1.10", config.PipelinesMap["build"].Steps[0].Data["go-version"])
+
+	yamlFile = s.writeFiles(map[string]string{
+		"wercker.yml": "include: a.yml\n",
+		"a.yml":       "build:\n  steps:\n    - script:\n        code: [make\n",
+	})
+	_, err = s.load(yamlFile)
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), filepath.Join(s.WorkingDir(), "a.yml")+": yaml: line")
+}
+
+func (s *IncludeSuite) TestConfigFromYamlFileWithoutInclude() {
+	yamlFile := s.writeFiles(map[string]string{
+		"wercker.yml": "build:\n  steps:\n    - script:\n        code: make\n",
+	})
+	config, err := s.load(yamlFile)
+	s.Require().Nil(err)
+	s.Equal(map[string]string{"build": yamlFile}, config.PipelineSources)
+}
+
+func (s *IncludeSuite) TestConfigFromYamlFileErrors() {
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{map[string]string{
+			"wercker.yml": "include: [a.yml]\n",
+			"a.yml":       "include: [b.yml]\n",
+			"b.yml":       "include: [a.yml]\n",
+		}, "include cycle"},
+		{map[string]string{
+			"wercker.yml": "include: [a.yml]\nbuild:\n  box: alpine\n",
+			"a.yml":       "build:\n  box: golang\n",
+		}, "pipeline build is defined in both"},
+		{map[string]string{
+			"wercker.yml": "include: a.yml\nworkflows:\n  - name: w\n",
+			"a.yml":       "workflows:\n  - name: w\n",
+		}, "workflow w is defined in both"},
+		{map[string]string{
+			"wercker.yml": "include: a.yml\n",
+			"a.yml":       "box: golang\n",
+		}, "box can only be set in the main wercker.yml"},
+		{map[string]string{
+			"wercker.yml": "include: missing.yml\n",
+		}, "included file missing.yml does not exist"},
+	}
+
+	for _, test := range tests {
+		os.RemoveAll(s.WorkingDir())
+		yamlFile := s.writeFiles(test.files)
+		_, err := s.load(yamlFile)
+		s.Require().NotNil(err)
+		s.Contains(err.Error(), test.expected)
+	}
+}
@@ -0,0 +1,242 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Merge strategies for the sections of a pipeline that extends another
+// pipeline or template. They are set per section with the `merge` key:
+//
+//	test:
+//	  extends: base
+//	  merge:
+//	    steps: prepend
+//	    after-steps: replace
+//
+// Sections without an explicit strategy use MergeAppend.
+const (
+	// MergeAppend runs the parent's entries first, followed by the child's
+	MergeAppend = "append"
+	// MergePrepend runs the child's entries first, followed by the parent's
+	MergePrepend = "prepend"
+	// MergeReplace uses only the child's entries if it sets the section, an
+	// empty list drops the parent's entries
+	MergeReplace = "replace"
+)
+
+// mergeableSections are the pipeline sections that accept a merge strategy.
+// Scalar sections (box, base-path, docker, timeout, matrix) and deploy targets
+// are always overridden by the child when it sets them, env variables are combined with
+// the child's values taking precedence.
+var mergeableSections = map[string]struct{}{
+	"steps":       struct{}{},
+	"after-steps": struct{}{},
+	"on-success":  struct{}{},
+	"on-failure":  struct{}{},
+	"always":      struct{}{},
+	"services":    struct{}{},
+}
+
+// ResolveExtends flattens every pipeline and template that uses `extends`
+// so that the rest of wercker only ever sees complete pipelines. Parents are
+// looked up in the pipelines first and in the templates second.
+func (c *Config) ResolveExtends() error {
+	names := []string{}
+	for name := range c.PipelinesMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	templateNames := []string{}
+	for name := range c.Templates {
+		templateNames = append(templateNames, name)
+	}
+	sort.Strings(templateNames)
+
+	// The merge strategies are checked up front, a pipeline that does not
+	// extend anything would not get to use them
+	for _, name := range names {
+		if err := c.PipelinesMap[name].validateMerge(); err != nil {
+			return errors.Wrapf(err, "pipeline %s", name)
+		}
+	}
+	for _, name := range templateNames {
+		if err := c.Templates[name].validateMerge(); err != nil {
+			return errors.Wrapf(err, "template %s", name)
+		}
+	}
+
+	for _, name := range names {
+		if err := c.resolvePipeline(name, c.PipelinesMap[name], nil); err != nil {
+			return err
+		}
+	}
+	for _, name := range templateNames {
+		if err := c.resolvePipeline(name, c.Templates[name], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMerge checks the merge strategies of a pipeline or template
+func (r *RawPipelineConfig) validateMerge() error {
+	if r == nil || r.PipelineConfig == nil || len(r.Merge) == 0 {
+		return nil
+	}
+	if r.Extends == "" {
+		return errors.New("sets merge without extends")
+	}
+	sections := []string{}
+	for section := range r.Merge {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		if _, ok := mergeableSections[section]; !ok {
+			return errors.Errorf("cannot set a merge strategy for %s", section)
+		}
+		switch strategy := r.Merge[section]; strategy {
+		case MergeAppend, MergePrepend, MergeReplace:
+		default:
+			return errors.Errorf("unknown merge strategy %s for %s, expected one of %s, %s or %s",
+				strategy, section, MergeAppend, MergePrepend, MergeReplace)
+		}
+	}
+	return nil
+}
+
+// lookupParent returns the pipeline or template called name, pipelines take
+// precedence over templates.
+func (c *Config) lookupParent(name string) (*RawPipelineConfig, bool) {
+	if p, ok := c.PipelinesMap[name]; ok {
+		return p, true
+	}
+	if p, ok := c.Templates[name]; ok {
+		return p, true
+	}
+	return nil, false
+}
+
+func (c *Config) resolvePipeline(name string, pipeline *RawPipelineConfig, chain []string) error {
+	if pipeline == nil || pipeline.PipelineConfig == nil || pipeline.Extends == "" {
+		return nil
+	}
+	if pipeline.extendsResolved {
+		return nil
+	}
+
+	chain = append(chain, name)
+	parentName := pipeline.Extends
+	for i, seen := range chain {
+		if seen == parentName {
+			cycle := append(chain[i:], parentName)
+			return errors.Errorf("pipeline inheritance contains cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	parent, ok := c.lookupParent(parentName)
+	if !ok {
+		return errors.Errorf("pipeline %s extends unknown pipeline or template %s", name, parentName)
+	}
+
+	err := c.resolvePipeline(parentName, parent, chain)
+	if err != nil {
+		return err
+	}
+
+	pipeline.PipelineConfig.inherit(parent)
+	pipeline.extendsResolved = true
+	return nil
+}
+
+// inherit merges the parent's configuration into p following the merge
+// strategies configured on p.
+func (p *PipelineConfig) inherit(parent *RawPipelineConfig) {
+	if parent == nil || parent.PipelineConfig == nil {
+		return
+	}
+
+	if p.Box == nil {
+		p.Box = parent.Box
+	}
+	if p.BasePath == "" {
+		p.BasePath = parent.BasePath
+	}
+	if !p.Docker {
+		p.Docker = parent.Docker
+	}
+	if p.Timeout == 0 {
+		p.Timeout = parent.Timeout
+	}
+	if p.Matrix == nil {
+		p.Matrix = parent.Matrix
+	}
+
+	// The child's variables are applied after the parent's so they win
+	p.Env = append(append(EnvConfig{}, parent.Env...), p.Env...)
+
+	p.Steps = mergeSteps(parent.Steps, p.Steps, p.mergeStrategy("steps"))
+	p.AfterSteps = mergeSteps(parent.AfterSteps, p.AfterSteps, p.mergeStrategy("after-steps"))
+	p.OnSuccess = mergeSteps(parent.OnSuccess, p.OnSuccess, p.mergeStrategy("on-success"))
+	p.OnFailure = mergeSteps(parent.OnFailure, p.OnFailure, p.mergeStrategy("on-failure"))
+	p.Always = mergeSteps(parent.Always, p.Always, p.mergeStrategy("always"))
+
+	switch p.mergeStrategy("services") {
+	case MergeReplace:
+		if p.Services == nil {
+			p.Services = parent.Services
+		}
+	case MergePrepend:
+		p.Services = append(append([]*RawBoxConfig{}, p.Services...), parent.Services...)
+	default:
+		p.Services = append(append([]*RawBoxConfig{}, parent.Services...), p.Services...)
+	}
+
+	if p.StepsMap == nil {
+		p.StepsMap = make(map[string][]*RawStepConfig)
+	}
+	for target, steps := range parent.StepsMap {
+		if _, ok := p.StepsMap[target]; !ok {
+			p.StepsMap[target] = steps
+		}
+	}
+}
+
+func (p *PipelineConfig) mergeStrategy(section string) string {
+	if strategy, ok := p.Merge[section]; ok {
+		return strategy
+	}
+	return MergeAppend
+}
+
+func mergeSteps(parent, child RawStepsConfig, strategy string) RawStepsConfig {
+	switch strategy {
+	case MergeReplace:
+		// An unset section is nil, `steps: []` is an empty list
+		if child == nil {
+			return parent
+		}
+		return child
+	case MergePrepend:
+		return append(append(RawStepsConfig{}, child...), parent...)
+	default:
+		return append(append(RawStepsConfig{}, parent...), child...)
+	}
+}
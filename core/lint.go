@@ -0,0 +1,129 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Severities of a ConfigProblem
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ConfigProblem is a single problem found in a wercker.yml
+type ConfigProblem struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+	// Path is the location of the offending node, e.g. build.steps[0]
+	Path string
+}
+
+// String formats the problem the way compilers do, file:line:col: message
+func (p *ConfigProblem) String() string {
+	msg := p.Message
+	if p.Path != "" {
+		msg = fmt.Sprintf("%s: %s", p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", p.File, p.Line, p.Column, p.Severity, msg)
+}
+
+// IsError is true for problems that make the config unusable
+func (p *ConfigProblem) IsError() bool {
+	return p.Severity == SeverityError
+}
+
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// LintConfig validates the wercker.yml in data against ConfigSchema and the
+// semantic checks done by ConfigFromYamlFile, returning every problem found
+// ordered by position. filename is only used for reporting.
+func LintConfig(filename string, data []byte) []*ConfigProblem {
+	problems := []*ConfigProblem{}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return append(problems, yamlErrorProblem(filename, err))
+	}
+
+	validator, err := newSchemaValidator(ConfigSchema)
+	if err != nil {
+		return append(problems, &ConfigProblem{File: filename, Line: 1, Column: 1, Severity: SeverityError, Message: err.Error()})
+	}
+
+	positions := scanYamlPositions(data)
+	for _, issue := range validator.validate(doc, validator.root, yamlPath{}) {
+		problem := &ConfigProblem{
+			File:     filename,
+			Line:     1,
+			Column:   1,
+			Severity: SeverityError,
+			Message:  issue.message,
+			Path:     issue.path.String(),
+		}
+		if issue.warning {
+			problem.Severity = SeverityWarning
+		}
+		if pos, ok := positions.lookup(issue.path); ok {
+			problem.Line = pos.Line
+			problem.Column = pos.Column
+		}
+		problems = append(problems, problem)
+	}
+
+	// Only run the semantic checks once the shape is right, otherwise they
+	// would mostly repeat the schema errors.
+	if !hasConfigErrors(problems) {
+		if _, err := ConfigFromYamlFile(filename, data); err != nil {
+			problems = append(problems, yamlErrorProblem(filename, err))
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+	return problems
+}
+
+func hasConfigErrors(problems []*ConfigProblem) bool {
+	for _, problem := range problems {
+		if problem.IsError() {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlErrorProblem turns a parse error into a problem, using the line number
+// from the error message when there is one.
+func yamlErrorProblem(filename string, err error) *ConfigProblem {
+	problem := &ConfigProblem{File: filename, Line: 1, Column: 1, Severity: SeverityError, Message: err.Error()}
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		problem.Line, _ = strconv.Atoi(m[1])
+	}
+	return problem
+}
@@ -0,0 +1,148 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type LintSuite struct {
+	*util.TestSuite
+}
+
+func TestLintSuite(t *testing.T) {
+	suiteTester := &LintSuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *LintSuite) TestConfigSchemaIsJSON() {
+	var schema map[string]interface{}
+	err := json.Unmarshal([]byte(ConfigSchema), &schema)
+	s.Nil(err)
+	_, err = newSchemaValidator(ConfigSchema)
+	s.Nil(err)
+}
+
+func (s *LintSuite) TestLintConfigFixtures() {
+	for _, fixture := range []string{"box_strings.yml", "box_structs.yml", "pipeline_extends.yml"} {
+		data, err := ioutil.ReadFile("../tests/" + fixture)
+		s.Require().Nil(err)
+		for _, problem := range LintConfig(fixture, data) {
+			s.False(problem.IsError(), problem.String())
+		}
+	}
+}
+
+func (s *LintSuite) TestLintConfigPositions() {
+	yml := `box:
+  id: golang
+  tga: "1.11"
+build:
+  steps:
+    - script:
+        name: test
+        code: go test
+    - script:
+      name: legacy
+      code: echo
+  afer-steps:
+    - slack-notifier
+  base-path: 1
+deploy:
+  steps:
+    - script:
+        code: deploy
+  production:
+    - script:
+        code: deploy
+`
+	problems := LintConfig("wercker.yml", []byte(yml))
+	actual := []string{}
+	for _, problem := range problems {
+		actual = append(actual, problem.String())
+	}
+	s.Equal([]string{
+		"wercker.yml:3:3: error: box.tga: unknown key tga (did you mean tag?)",
+		"wercker.yml:9:5: warning: build.steps[1]: step properties should be nested under the step name",
+		"wercker.yml:12:3: warning: build.afer-steps: deploy targets are deprecated, use a separate pipeline and a workflow instead (did you mean after-steps?)",
+		"wercker.yml:14:3: error: build.base-path: expected string but found integer",
+		"wercker.yml:19:3: warning: deploy.production: deploy targets are deprecated, use a separate pipeline and a workflow instead",
+	}, actual)
+}
+
+func (s *LintSuite) TestLintConfigStepOptions() {
+	yml := `box: golang
+build:
+  steps:
+    - script:
+        code: go get ./...
+        timeout: 10
+        retry:
+          attempts: 3
+          delay: 10s
+          on-exit-codes: [1]
+    - parallel:
+        - script:
+            code: make lint
+            allow-failure: true
+        - script:
+            code: make test
+    - script:
+        code: make
+        retry:
+          attempts: 2
+          backof: 2
+`
+	problems := LintConfig("wercker.yml", []byte(yml))
+	actual := []string{}
+	for _, problem := range problems {
+		actual = append(actual, problem.String())
+	}
+	s.Equal([]string{
+		"wercker.yml:21:11: error: build.steps[2].script.retry.backof: unknown key backof",
+	}, actual)
+}
+
+func (s *LintSuite) TestLintConfigSemantic() {
+	yml := `box: golang
+build:
+  extends: missing
+  steps:
+    - script:
+        code: go test
+`
+	problems := LintConfig("wercker.yml", []byte(yml))
+	s.Require().Equal(1, len(problems))
+	s.True(problems[0].IsError())
+	s.Contains(problems[0].Message, "extends unknown pipeline or template missing")
+}
+
+func (s *LintSuite) TestLintConfigSyntaxError() {
+	yml := `box: golang
+build:
+  steps:
+    - script:
+        code: [go test
+`
+	problems := LintConfig("wercker.yml", []byte(yml))
+	s.Require().Equal(1, len(problems))
+	s.True(problems[0].IsError())
+	s.NotEqual(1, problems[0].Line)
+}
@@ -0,0 +1,140 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MatrixConfig describes the variations a pipeline should be run with, every
+// combination of box tag and env set results in a separate pipeline:
+//
+//	test:
+//	  box: golang
+//	  matrix:
+//	    tags:
+//	      - "1.10"
+//	      - "1.11"
+//	    env:
+//	      - GO111MODULE: "on"
+//	      - GO111MODULE: "off"
+type MatrixConfig struct {
+	Tags []string            `yaml:"tags"`
+	Env  []map[string]string `yaml:"env"`
+}
+
+// MatrixExpansion is a single combination of a MatrixConfig
+type MatrixExpansion struct {
+	Tag string
+	Env [][]string
+}
+
+// Label describes the expansion, for example "tag=1.11 GO111MODULE=on"
+func (e *MatrixExpansion) Label() string {
+	parts := []string{}
+	if e.Tag != "" {
+		parts = append(parts, fmt.Sprintf("tag=%s", e.Tag))
+	}
+	for _, pair := range e.Env {
+		parts = append(parts, fmt.Sprintf("%s=%s", pair[0], pair[1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Expansions returns all the combinations of the matrix, in the order they
+// were defined.
+func (m *MatrixConfig) Expansions() []*MatrixExpansion {
+	tags := m.Tags
+	if len(tags) == 0 {
+		tags = []string{""}
+	}
+	envs := m.Env
+	if len(envs) == 0 {
+		envs = []map[string]string{nil}
+	}
+
+	expansions := []*MatrixExpansion{}
+	for _, tag := range tags {
+		for _, env := range envs {
+			keys := []string{}
+			for k := range env {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			pairs := [][]string{}
+			for _, k := range keys {
+				pairs = append(pairs, []string{k, env[k]})
+			}
+			expansions = append(expansions, &MatrixExpansion{Tag: tag, Env: pairs})
+		}
+	}
+	return expansions
+}
+
+// ExpandMatrices adds a concrete pipeline to the config for every expansion
+// of a pipeline's matrix. The expansions are named after the pipeline with a
+// numeric suffix (build-1, build-2, ...) and are listed on the original
+// pipeline in MatrixPipelines.
+func (c *Config) ExpandMatrices() error {
+	names := []string{}
+	for name, pipeline := range c.PipelinesMap {
+		if pipeline != nil && pipeline.PipelineConfig != nil && pipeline.Matrix != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pipeline := c.PipelinesMap[name]
+		if len(pipeline.MatrixPipelines) > 0 {
+			continue
+		}
+
+		for i, expansion := range pipeline.Matrix.Expansions() {
+			expandedName := fmt.Sprintf("%s-%d", name, i+1)
+			if _, ok := c.PipelinesMap[expandedName]; ok {
+				return errors.Errorf("matrix expansion %s of pipeline %s conflicts with an existing pipeline", expandedName, name)
+			}
+
+			expanded := *pipeline.PipelineConfig
+			expanded.Matrix = nil
+			expanded.MatrixPipelines = nil
+			expanded.MatrixParent = name
+			expanded.MatrixExpansion = expansion
+
+			if expansion.Tag != "" {
+				box := pipeline.Box
+				if box == nil {
+					box = c.Box
+				}
+				if box == nil {
+					return errors.Errorf("pipeline %s varies the box tag in its matrix but has no box", name)
+				}
+				boxConfig := *box.BoxConfig
+				boxConfig.Tag = expansion.Tag
+				expanded.Box = &RawBoxConfig{BoxConfig: &boxConfig}
+			}
+
+			c.PipelinesMap[expandedName] = &RawPipelineConfig{PipelineConfig: &expanded}
+			pipeline.MatrixPipelines = append(pipeline.MatrixPipelines, expandedName)
+		}
+	}
+	return nil
+}
@@ -381,6 +381,16 @@ type PipelineOptions struct {
 	ShouldStore bool
 
 	WorkingDir string
+	// Namespace keeps the project directories of pipelines that run side by
+	// side, such as matrix expansions, apart
+	Namespace string
+	// SeparateCache gives the pipeline a cache directory of its own under
+	// its Namespace, for matrix expansions that run at the same time.
+	// Otherwise pipelines share the cache.
+	SeparateCache bool
+	// LogPrefix is put in front of every line of output of pipelines that
+	// run side by side, so their logs can be told apart
+	LogPrefix string
 
 	GuestRoot  string
 	MntRoot    string
@@ -397,6 +407,7 @@ type PipelineOptions struct {
 
 	CommandTimeout    int
 	NoResponseTimeout int
+	PipelineTimeout   int
 	ShouldArtifacts   bool
 	ShouldRemove      bool
 	SourceDir         string
@@ -410,10 +421,15 @@ type PipelineOptions struct {
 	EnableVolumes  bool
 	WerckerYml     string
 	Checkpoint     string
+	// FailureBox runs the after-steps when the box of the pipeline could
+	// not be set up
+	FailureBox string
 
 	DefaultsUsed PipelineDefaultsUsed
 
 	WorkflowsInYml bool
+
+	MatrixParallel bool
 }
 
 type PipelineDefaultsUsed struct {
@@ -626,12 +642,14 @@ func NewPipelineOptions(c util.Settings, e *util.Environment) (*PipelineOptions,
 	enableVolumes, _ := c.Bool("enable-volumes")
 	werckerYml, _ := c.String("wercker-yml")
 	checkpoint, _ := c.String("checkpoint")
+	failureBox, _ := c.String("failure-box")
 
 	defaultsUsed := PipelineDefaultsUsed{
 		IgnoreFile: !ignoreFileSet,
 	}
 
 	workflowsInYml, _ := c.Bool("workflows-in-yml")
+	matrixParallel, _ := c.Bool("matrix-parallel")
 
 	return &PipelineOptions{
 		GlobalOptions: globalOpts,
@@ -688,10 +706,13 @@ func NewPipelineOptions(c util.Settings, e *util.Environment) (*PipelineOptions,
 		EnableVolumes: enableVolumes,
 		WerckerYml:    werckerYml,
 		Checkpoint:    checkpoint,
+		FailureBox:    failureBox,
 
 		DefaultsUsed: defaultsUsed,
 
 		WorkflowsInYml: workflowsInYml,
+
+		MatrixParallel: matrixParallel,
 	}, nil
 }
 
@@ -748,6 +769,9 @@ func (o *PipelineOptions) BuildPath(s ...string) string {
 
 // CachePath returns the path for storing pipeline cache
 func (o *PipelineOptions) CachePath() string {
+	if o.SeparateCache {
+		return path.Join(o.WorkingDir, "cache", o.Namespace)
+	}
 	return path.Join(o.WorkingDir, "cache")
 }
 
@@ -797,13 +821,26 @@ func NewDevOptions(c util.Settings, e *util.Environment) (*PipelineOptions, erro
 	return pipelineOpts, nil
 }
 
+// CheckConfigOptions for the check-config command
+type CheckConfigOptions struct {
+	*PipelineOptions
+	Strict      bool
+	PrintSchema bool
+}
+
 // NewCheckConfigOptions constructor
-func NewCheckConfigOptions(c util.Settings, e *util.Environment) (*PipelineOptions, error) {
+func NewCheckConfigOptions(c util.Settings, e *util.Environment) (*CheckConfigOptions, error) {
 	pipelineOpts, err := NewPipelineOptions(c, e)
 	if err != nil {
 		return nil, err
 	}
-	return pipelineOpts, nil
+	strict, _ := c.Bool("strict")
+	printSchema, _ := c.Bool("schema")
+	return &CheckConfigOptions{
+		PipelineOptions: pipelineOpts,
+		Strict:          strict,
+		PrintSchema:     printSchema,
+	}, nil
 }
 
 // NewDeployOptions constructor
@@ -838,6 +875,28 @@ func NewDeployOptions(c util.Settings, e *util.Environment) (*PipelineOptions, e
 	return pipelineOpts, nil
 }
 
+// FormatOptions for the fmt command
+type FormatOptions struct {
+	*GlobalOptions
+	WerckerYml string
+	Write      bool
+}
+
+// NewFormatOptions constructor
+func NewFormatOptions(c util.Settings, e *util.Environment) (*FormatOptions, error) {
+	globalOpts, err := NewGlobalOptions(c, e)
+	if err != nil {
+		return nil, err
+	}
+	werckerYml, _ := c.String("wercker-yml")
+	write, _ := c.Bool("write")
+	return &FormatOptions{
+		GlobalOptions: globalOpts,
+		WerckerYml:    werckerYml,
+		Write:         write,
+	}, nil
+}
+
 // DetectOptions for detect command
 type DetectOptions struct {
 	*GlobalOptions
@@ -1107,6 +1166,27 @@ func NewExternalRunnerOptions(c util.Settings, e *util.Environment) (*WerckerRun
 type WorkflowOptions struct {
 	PipelineOptions PipelineOptions
 	WorkflowName    string
+	// MaxParallel is the number of pipelines that can run at the same time,
+	// there is no limit when it is 0
+	MaxParallel int
+	// KeepGoing lets the pipelines that do not depend on a failed pipeline
+	// run, instead of cancelling them
+	KeepGoing bool
+	// Resume is the ID of a workflow run to continue, reusing the pipelines
+	// that passed in it
+	Resume string
+	// Plan prints what the workflow would run instead of running it
+	Plan bool
+	// GraphFormat is the format workflow graph prints the workflow in
+	GraphFormat string
+	// AutoApprove runs the pipelines that need approval without asking
+	AutoApprove bool
+	// StopAtApproval stops the workflow before the pipelines that need
+	// approval instead of asking, resuming the run approves them
+	StopAtApproval bool
+	// BaseRef is the git ref the path filters of the pipelines compare the
+	// project to, only uncommitted changes count when it is empty
+	BaseRef string
 }
 
 // NewWorkflowOptions is a contructor for WorkflowOptions.
@@ -1116,7 +1196,111 @@ func NewWorkflowOptions(c util.Settings, e *util.Environment) (*WorkflowOptions,
 		return nil, err
 	}
 
+	maxParallel, _ := c.Int("max-parallel")
+	keepGoing, _ := c.Bool("keep-going")
+	resume, _ := c.String("resume")
+	plan, _ := c.Bool("plan")
+	graphFormat, _ := c.String("format")
+	autoApprove, _ := c.Bool("auto-approve")
+	stopAtApproval, _ := c.Bool("stop-at-approval")
+	baseRef, _ := c.String("base-ref")
+
+	if autoApprove && stopAtApproval {
+		return nil, errors.New("--auto-approve and --stop-at-approval cannot be used together")
+	}
+
 	return &WorkflowOptions{
 		PipelineOptions: *pipelineOpts,
+		MaxParallel:     maxParallel,
+		KeepGoing:       keepGoing,
+		Resume:          resume,
+		Plan:            plan,
+		GraphFormat:     graphFormat,
+		AutoApprove:     autoApprove,
+		StopAtApproval:  stopAtApproval,
+		BaseRef:         baseRef,
+	}, nil
+}
+
+// RunsOptions for the runs commands
+type RunsOptions struct {
+	*GlobalOptions
+	WorkingDir string
+	// RunID is the run runs show shows
+	RunID string
+	// Pipeline, Branch and Result filter the runs runs list shows
+	Pipeline string
+	Branch   string
+	Result   string
+	// Limit is the number of runs runs list shows, 0 for all of them
+	Limit int
+	// Logs makes runs show print the logs of the run
+	Logs bool
+}
+
+// NewRunsOptions constructor
+func NewRunsOptions(c util.Settings, e *util.Environment) (*RunsOptions, error) {
+	globalOpts, err := NewGlobalOptions(c, e)
+	if err != nil {
+		return nil, err
+	}
+	workingDir, _ := c.String("working-dir")
+	workingDir, _ = filepath.Abs(workingDir)
+	pipeline, _ := c.String("pipeline")
+	branch, _ := c.String("branch")
+	result, _ := c.String("result")
+	limit, _ := c.Int("limit")
+	logs, _ := c.Bool("logs")
+	return &RunsOptions{
+		GlobalOptions: globalOpts,
+		WorkingDir:    workingDir,
+		Pipeline:      pipeline,
+		Branch:        branch,
+		Result:        result,
+		Limit:         limit,
+		Logs:          logs,
+	}, nil
+}
+
+// LogsOptions for the logs command
+type LogsOptions struct {
+	*GlobalOptions
+	WorkingDir string
+	RunID      string
+	// Step and Stream only show the logs of a step or a stream
+	Step   string
+	Stream string
+	// Grep only shows the lines matching this regular expression
+	Grep string
+	// Follow keeps showing the logs until the run finishes
+	Follow bool
+}
+
+// NewLogsOptions constructor
+func NewLogsOptions(c util.Settings, e *util.Environment) (*LogsOptions, error) {
+	globalOpts, err := NewGlobalOptions(c, e)
+	if err != nil {
+		return nil, err
+	}
+	workingDir, _ := c.String("working-dir")
+	workingDir, _ = filepath.Abs(workingDir)
+	step, _ := c.String("step")
+	stream, _ := c.String("stream")
+	grep, _ := c.String("grep")
+	follow, _ := c.Bool("follow")
+
+	switch stream {
+	case "", "stdout", "stderr", "stdin":
+	default:
+		return nil, fmt.Errorf("--stream must be stdout, stderr or stdin, not %s", stream)
+	}
+
+	return &LogsOptions{
+		GlobalOptions: globalOpts,
+		WorkingDir:    workingDir,
+		Step:          step,
+		Stream:        stream,
+		Grep:          grep,
+		Follow:        follow,
 	}, nil
 }
@@ -0,0 +1,117 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pborman/uuid"
+	"github.com/wercker/wercker/util"
+	"golang.org/x/net/context"
+)
+
+// ParallelStep is a group of steps that run at the same time. It reports as
+// a step, and so does each of its steps. The runner gives each of its steps
+// its own shell in the box container and the group fails if any of them
+// fails.
+type ParallelStep struct {
+	*BaseStep
+	steps []Step
+}
+
+// NewParallelStep makes a group out of steps that were already created from
+// the Parallel steps of stepConfig
+func NewParallelStep(stepConfig *StepConfig, steps []Step) *ParallelStep {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.DisplayName())
+	}
+	displayName := fmt.Sprintf("parallel (%s)", strings.Join(names, ", "))
+	if stepConfig.Name != "" {
+		displayName = stepConfig.Name
+	}
+
+	baseOptions := NewBaseStepOptions(stepConfig)
+	baseOptions.DisplayName = displayName
+	baseOptions.Env = util.NewEnvironment()
+	baseOptions.ID = "parallel"
+	baseOptions.Name = "parallel"
+	baseOptions.Owner = "wercker"
+	baseOptions.SafeID = fmt.Sprintf("parallel-%s", uuid.NewRandom().String())
+	baseOptions.Version = util.Version()
+	baseOptions.Checkpoint = stepConfig.Checkpoint
+
+	return &ParallelStep{
+		BaseStep: NewBaseStep(baseOptions),
+		steps:    steps,
+	}
+}
+
+// Steps returns the steps in the group
+func (s *ParallelStep) Steps() []Step {
+	return s.steps
+}
+
+// Fetch fetches every step in the group
+func (s *ParallelStep) Fetch() (string, error) {
+	for _, step := range s.steps {
+		if _, err := step.Fetch(); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// InitEnv NOP, the steps in the group are initialized when they run
+func (s *ParallelStep) InitEnv(ctx context.Context, env *util.Environment) error {
+	return nil
+}
+
+// Execute is not supported, a group needs a session for each of its steps
+// so it is run by the runner
+func (s *ParallelStep) Execute(ctx context.Context, sess *Session) (int, error) {
+	return 1, fmt.Errorf("%s can not be executed in a single session", s.DisplayName())
+}
+
+// CollectFile NOP
+func (s *ParallelStep) CollectFile(a, b, c string, dst io.Writer) error {
+	return util.ErrEmptyTarball
+}
+
+// CollectArtifact NOP
+func (s *ParallelStep) CollectArtifact(context.Context, string) (*Artifact, error) {
+	return nil, nil
+}
+
+// ReportPath NOP
+func (s *ParallelStep) ReportPath(...string) string {
+	// for now we just want something that doesn't exist
+	return uuid.NewRandom().String()
+}
+
+// ShouldSyncEnv before the group so its steps start from the current
+// environment of the main session
+func (s *ParallelStep) ShouldSyncEnv() bool {
+	return true
+}
+
+// Clean cleans up every step in the group
+func (s *ParallelStep) Clean() {
+	for _, step := range s.steps {
+		step.Clean()
+	}
+}
@@ -17,6 +17,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -53,12 +54,14 @@ type Pipeline interface {
 	Services() []ServiceBox //base
 	Steps() []Step          // base
 	AfterSteps() []Step     // base
+	AfterStepsFor(bool) []Step
 
 	// Methods
 	CommonEnv() [][]string                      // base
 	InitEnv(context.Context, *util.Environment) // impl
 	CollectArtifact(context.Context, string) (*Artifact, error)
 	CollectCache(context.Context, string) error
+	CollectOutputs(context.Context, string) error
 	LocalSymlink()
 	SetupGuest(context.Context, *Session) error
 	ExportEnvironment(context.Context, *Session) error
@@ -78,10 +81,12 @@ type PipelineResult struct {
 	Success           bool
 	FailedStepName    string
 	FailedStepMessage string
+	// Warnings holds the failures of steps that were allowed to fail
+	Warnings []string
 }
 
-// ExportEnvironment for this pipeline result (used in after-steps)
-func (pr *PipelineResult) ExportEnvironment(sessionCtx context.Context, sess *Session) error {
+// Env returns the environment describing this pipeline result
+func (pr *PipelineResult) Env() *util.Environment {
 	e := util.NewEnvironment()
 	result := "failed"
 	if pr.Success {
@@ -92,6 +97,25 @@ func (pr *PipelineResult) ExportEnvironment(sessionCtx context.Context, sess *Se
 		e.Add("WERCKER_FAILED_STEP_DISPLAY_NAME", pr.FailedStepName)
 		e.Add("WERCKER_FAILED_STEP_MESSAGE", pr.FailedStepMessage)
 	}
+	if len(pr.Warnings) > 0 {
+		e.Add("WERCKER_WARNINGS", strings.Join(pr.Warnings, "; "))
+	}
+	return e
+}
+
+// AddWarning records the failure of a step that was allowed to fail
+func (pr *PipelineResult) AddWarning(stepName, message string) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		pr.Warnings = append(pr.Warnings, stepName)
+		return
+	}
+	pr.Warnings = append(pr.Warnings, fmt.Sprintf("%s: %s", stepName, strings.Replace(message, "\n", " ", -1)))
+}
+
+// ExportEnvironment for this pipeline result (used in after-steps)
+func (pr *PipelineResult) ExportEnvironment(sessionCtx context.Context, sess *Session) error {
+	e := pr.Env()
 
 	exit, _, err := sess.SendChecked(sessionCtx, e.Export()...)
 	if err != nil {
@@ -106,24 +130,38 @@ func (pr *PipelineResult) ExportEnvironment(sessionCtx context.Context, sess *Se
 type BasePipelineOptions struct {
 	Options    *PipelineOptions
 	Config     *PipelineConfig
+	GlobalEnv  EnvConfig
 	Env        *util.Environment
 	Box        Box
 	Services   []ServiceBox
 	Steps      []Step
 	AfterSteps []Step
 	Logger     *util.LogEntry
+
+	// AfterInitStep prepares the box for the steps that run after the
+	// steps, it is only used when there are any
+	AfterInitStep  Step
+	OnSuccessSteps []Step
+	OnFailureSteps []Step
+	AlwaysSteps    []Step
 }
 
 // BasePipeline is the base class for Build and Deploy
 type BasePipeline struct {
 	options    *PipelineOptions
 	config     *PipelineConfig
+	globalEnv  EnvConfig
 	env        *util.Environment
 	box        Box
 	services   []ServiceBox
 	steps      []Step
 	afterSteps []Step
 	logger     *util.LogEntry
+
+	afterInitStep  Step
+	onSuccessSteps []Step
+	onFailureSteps []Step
+	alwaysSteps    []Step
 }
 
 func NewBasePipeline(args BasePipelineOptions) *BasePipeline {
@@ -131,12 +169,18 @@ func NewBasePipeline(args BasePipelineOptions) *BasePipeline {
 	return &BasePipeline{
 		options:    args.Options,
 		config:     args.Config,
+		globalEnv:  args.GlobalEnv,
 		env:        args.Env,
 		box:        args.Box,
 		services:   args.Services,
 		steps:      args.Steps,
 		afterSteps: args.AfterSteps,
 		logger:     args.Logger,
+
+		afterInitStep:  args.AfterInitStep,
+		onSuccessSteps: args.OnSuccessSteps,
+		onFailureSteps: args.OnFailureSteps,
+		alwaysSteps:    args.AlwaysSteps,
 	}
 
 }
@@ -156,9 +200,34 @@ func (p *BasePipeline) Steps() []Step {
 	return p.steps
 }
 
-// AfterSteps is a getter for afterSteps
+// AfterSteps returns every step that may run after the steps: the
+// after-steps, on-success, on-failure and always
 func (p *BasePipeline) AfterSteps() []Step {
-	return p.afterSteps
+	return p.afterStepsWith(p.onSuccessSteps, p.onFailureSteps)
+}
+
+// AfterStepsFor returns the steps to run after steps that passed or failed:
+// the after-steps, then on-success or on-failure, then always
+func (p *BasePipeline) AfterStepsFor(success bool) []Step {
+	if success {
+		return p.afterStepsWith(p.onSuccessSteps)
+	}
+	return p.afterStepsWith(p.onFailureSteps)
+}
+
+func (p *BasePipeline) afterStepsWith(resultSteps ...[]Step) []Step {
+	steps := append([]Step{}, p.afterSteps...)
+	for _, s := range resultSteps {
+		steps = append(steps, s...)
+	}
+	steps = append(steps, p.alwaysSteps...)
+	if len(steps) == 0 {
+		return nil
+	}
+	if p.afterInitStep != nil {
+		steps = append([]Step{p.afterInitStep}, steps...)
+	}
+	return steps
 }
 
 // Env is a getter for env
@@ -166,6 +235,59 @@ func (p *BasePipeline) Env() *util.Environment {
 	return p.env
 }
 
+// MatrixEnv returns the env vars set by the matrix expansion this pipeline
+// was created from, if any
+func (p *BasePipeline) MatrixEnv() [][]string {
+	if p.config == nil || p.config.MatrixExpansion == nil {
+		return nil
+	}
+	return p.config.MatrixExpansion.Env
+}
+
+// YamlEnv returns the variables from the env sections of the wercker.yml,
+// interpolated against the passthru variables in hostEnv. The precedence,
+// from low to high, is: variables from the CLI environment file, the global
+// env section and the pipeline's env section, so a pipeline can override and
+// reference the global variables.
+//
+// Values that reference a protected (XXX_) variable are returned as hidden so
+// they do not show up in logs.
+func (p *BasePipeline) YamlEnv(hostEnv *util.Environment) (public [][]string, hidden [][]string) {
+	interp := util.NewEnvironment()
+	interp.Update(hostEnv.GetPassthru().Ordered())
+	interp.Hidden.Update(hostEnv.GetHiddenPassthru().Ordered())
+
+	sections := []EnvConfig{p.globalEnv}
+	if p.config != nil {
+		sections = append(sections, p.config.Env)
+	}
+	for _, section := range sections {
+		for _, pair := range section {
+			key, value := pair[0], interp.Interpolate(pair[1])
+			if referencesEnv(pair[1], interp.Hidden) {
+				hidden = append(hidden, []string{key, value})
+				interp.Hidden.Add(key, value)
+			} else {
+				public = append(public, []string{key, value})
+				interp.Add(key, value)
+			}
+		}
+	}
+	return public, hidden
+}
+
+// referencesEnv is true if s references any of the variables in env
+func referencesEnv(s string, env *util.Environment) bool {
+	found := false
+	os.Expand(s, func(key string) string {
+		if _, ok := env.Map[key]; ok {
+			found = true
+		}
+		return ""
+	})
+	return found
+}
+
 // CommonEnv is shared by both builds and deploys
 func (p *BasePipeline) CommonEnv() [][]string {
 	a := [][]string{
@@ -177,6 +299,7 @@ func (p *BasePipeline) CommonEnv() [][]string {
 		[]string{"WERCKER_OUTPUT_DIR", p.options.GuestPath("output")},
 		[]string{"WERCKER_PIPELINE_DIR", p.options.GuestPath()},
 		[]string{"WERCKER_REPORT_DIR", p.options.GuestPath("report")},
+		[]string{"WERCKER_OUTPUTS_FILE", p.options.GuestPath("report", "outputs.env")},
 		[]string{"WERCKER_APPLICATION_ID", p.options.ApplicationID},
 		[]string{"WERCKER_APPLICATION_NAME", p.options.ApplicationName},
 		[]string{"WERCKER_APPLICATION_OWNER_NAME", p.options.ApplicationOwnerName},
@@ -211,8 +334,9 @@ func (p *BasePipeline) SetupGuest(sessionCtx context.Context, sess *Session) err
 		)
 	}
 
-	// Make sure the output path exists
+	// Make sure the output and report paths exist
 	cmds = append(cmds, fmt.Sprintf(`mkdir -p "%s"`, p.options.GuestPath("output")))
+	cmds = append(cmds, fmt.Sprintf(`mkdir -p "%s"`, p.options.GuestPath("report")))
 
 	cmds = append(cmds, fmt.Sprintf(`chmod a+rx "%s"`, p.options.BasePath()))
 
@@ -260,6 +384,11 @@ func (p *BasePipeline) LogEnvironment() {
 	for _, pair := range p.env.Ordered() {
 		p.logger.Debugln(" ", pair[0], pair[1])
 	}
+	if p.env.Hidden != nil {
+		for _, pair := range p.env.Hidden.Ordered() {
+			p.logger.Debugln(" ", pair[0], "<hidden>")
+		}
+	}
 }
 
 // SyncEnvironment fetches the current environment from sess, and merges the
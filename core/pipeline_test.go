@@ -91,3 +91,81 @@ func (s *PipelineSuite) TestIsBuildIDInvalid3() {
 
 	s.Equal(false, ok)
 }
+
+func (s *PipelineSuite) TestYamlEnv() {
+	config, err := ConfigFromYaml([]byte(`
+box: alpine
+env:
+  REGION: $REGION
+  LEVEL: info
+build:
+  env:
+    LEVEL: debug
+    AUTH: Bearer $TOKEN
+    URL: https://$REGION.example.com
+    HEADER: $AUTH
+  steps:
+    - script:
+        code: env
+`))
+	s.Require().Nil(err)
+
+	pipeline := NewBasePipeline(BasePipelineOptions{
+		Options:   &PipelineOptions{},
+		Config:    config.PipelinesMap["build"].PipelineConfig,
+		GlobalEnv: config.Env,
+		Env:       util.NewEnvironment(),
+	})
+	hostEnv := util.NewEnvironment("X_REGION=eu", "XXX_TOKEN=secret", "HOME=/root")
+	public, hidden := pipeline.YamlEnv(hostEnv)
+
+	env := util.NewEnvironment()
+	env.Update(public)
+	env.Hidden.Update(hidden)
+	s.Equal("eu", env.Get("REGION"))
+	s.Equal("debug", env.Get("LEVEL"))
+	s.Equal("https://eu.example.com", env.Get("URL"))
+	s.Equal("", env.Get("AUTH"))
+	s.Equal("Bearer secret", env.Hidden.Get("AUTH"))
+	s.Equal("Bearer secret", env.Hidden.Get("HEADER"))
+}
+
+func (s *PipelineSuite) TestPipelineResultWarnings() {
+	pr := &PipelineResult{Success: true}
+	s.Equal([][]string{{"WERCKER_RESULT", "passed"}}, pr.Env().Ordered())
+
+	pr.AddWarning("coverage", "upload failed\nconnection refused\n")
+	pr.AddWarning("lint", "")
+	env := pr.Env()
+	s.Equal("passed", env.Get("WERCKER_RESULT"))
+	s.Equal("coverage: upload failed connection refused; lint", env.Get("WERCKER_WARNINGS"))
+}
+
+func (s *PipelineSuite) TestPipelineAfterStepsFor() {
+	step := func(name string) Step {
+		return &ExternalStep{BaseStep: NewBaseStep(BaseStepOptions{Name: name})}
+	}
+	initStep := step("wercker-init")
+	after := step("after")
+	success := step("success")
+	failure := step("failure")
+	always := step("always")
+
+	p := NewBasePipeline(BasePipelineOptions{
+		AfterSteps:     []Step{after},
+		AfterInitStep:  initStep,
+		OnSuccessSteps: []Step{success},
+		OnFailureSteps: []Step{failure},
+		AlwaysSteps:    []Step{always},
+	})
+	s.Equal([]Step{initStep, after, success, always}, p.AfterStepsFor(true))
+	s.Equal([]Step{initStep, after, failure, always}, p.AfterStepsFor(false))
+	s.Equal([]Step{initStep, after, success, failure, always}, p.AfterSteps())
+
+	p = NewBasePipeline(BasePipelineOptions{
+		AfterInitStep:  initStep,
+		OnFailureSteps: []Step{failure},
+	})
+	s.Nil(p.AfterStepsFor(true))
+	s.Equal([]Step{initStep, failure}, p.AfterStepsFor(false))
+}
@@ -0,0 +1,144 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultRetryDelay is used between attempts when a step does not set one
+	DefaultRetryDelay = 10 * time.Second
+	// MaxRetryDelay caps the delay between attempts as it backs off
+	MaxRetryDelay = 5 * time.Minute
+)
+
+// RetryConfig describes how a failing step is retried, it is configured with
+// the retry property of a step:
+//
+//	retry:
+//	  attempts: 3
+//	  delay: 10s
+//	  on-exit-codes: [1, 128]
+type RetryConfig struct {
+	// Attempts is the total number of times the step is run, including the
+	// first one
+	Attempts int
+	// Delay is the wait before the second attempt, it doubles for every
+	// attempt after that up to MaxRetryDelay
+	Delay time.Duration
+	// OnExitCodes limits the retries to these exit codes, when empty every
+	// failure is retried
+	OnExitCodes []int
+}
+
+// ShouldRetry tells whether a step that failed with exitCode on its attempt
+// numbered attempt (starting at 1) should be run again
+func (r *RetryConfig) ShouldRetry(attempt int, exitCode int) bool {
+	if r == nil || attempt >= r.Attempts {
+		return false
+	}
+	if len(r.OnExitCodes) == 0 {
+		return true
+	}
+	for _, code := range r.OnExitCodes {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns how long to wait after the attempt numbered attempt
+// (starting at 1) before running the step again
+func (r *RetryConfig) Backoff(attempt int) time.Duration {
+	delay := r.Delay
+	for i := 1; i < attempt && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	return delay
+}
+
+// parseRetryConfig builds a RetryConfig from the retry property of a step,
+// value is the plain representation made by yamlToPlain
+func parseRetryConfig(stepID string, value interface{}) (*RetryConfig, error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Step %s has an invalid retry, expected a map with attempts, delay and on-exit-codes", stepID)
+	}
+
+	retry := &RetryConfig{Delay: DefaultRetryDelay}
+	for key, v := range m {
+		switch key {
+		case "attempts":
+			attempts, ok := v.(int)
+			if !ok || attempts < 1 {
+				return nil, fmt.Errorf("Step %s has an invalid retry attempts %v, expected a positive number", stepID, v)
+			}
+			retry.Attempts = attempts
+		case "delay":
+			delay, err := parseRetryDelay(v)
+			if err != nil {
+				return nil, fmt.Errorf("Step %s has an invalid retry delay %v, expected a duration such as 10s", stepID, v)
+			}
+			retry.Delay = delay
+		case "on-exit-codes":
+			codes, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Step %s has an invalid retry on-exit-codes, expected a list of exit codes", stepID)
+			}
+			for _, c := range codes {
+				code, ok := c.(int)
+				if !ok {
+					return nil, fmt.Errorf("Step %s has an invalid retry exit code %v", stepID, c)
+				}
+				retry.OnExitCodes = append(retry.OnExitCodes, code)
+			}
+		default:
+			return nil, fmt.Errorf("Step %s has an unknown retry option %s", stepID, key)
+		}
+	}
+
+	if retry.Attempts == 0 {
+		return nil, fmt.Errorf("Step %s has a retry without attempts", stepID)
+	}
+	return retry, nil
+}
+
+// parseRetryDelay accepts a duration string or a number of seconds
+func parseRetryDelay(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return 0, fmt.Errorf("negative delay")
+		}
+		return time.Duration(v) * time.Second, nil
+	case string:
+		delay, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, err
+		}
+		if delay < 0 {
+			return 0, fmt.Errorf("negative delay")
+		}
+		return delay, nil
+	default:
+		return 0, fmt.Errorf("unsupported delay %v", value)
+	}
+}
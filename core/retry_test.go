@@ -0,0 +1,105 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type RetrySuite struct {
+	*util.TestSuite
+}
+
+func TestRetrySuite(t *testing.T) {
+	suiteTester := &RetrySuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *RetrySuite) TestShouldRetry() {
+	var none *RetryConfig
+	s.False(none.ShouldRetry(1, 1))
+
+	retry := &RetryConfig{Attempts: 3}
+	s.True(retry.ShouldRetry(1, 1))
+	s.True(retry.ShouldRetry(2, 255))
+	s.False(retry.ShouldRetry(3, 1))
+
+	retry.OnExitCodes = []int{1, 128}
+	s.True(retry.ShouldRetry(1, 128))
+	s.False(retry.ShouldRetry(1, 2))
+}
+
+func (s *RetrySuite) TestBackoff() {
+	retry := &RetryConfig{Attempts: 10, Delay: 10 * time.Second}
+	s.Equal(10*time.Second, retry.Backoff(1))
+	s.Equal(20*time.Second, retry.Backoff(2))
+	s.Equal(40*time.Second, retry.Backoff(3))
+	s.Equal(MaxRetryDelay, retry.Backoff(9))
+
+	retry.Delay = 0
+	s.Equal(time.Duration(0), retry.Backoff(3))
+}
+
+func (s *RetrySuite) TestConfigRetry() {
+	config, err := ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: npm install
+        retry:
+          attempts: 3
+          delay: 30s
+          on-exit-codes: [1, 128]
+    - script:
+        code: docker push
+        retry:
+          attempts: 2
+    - script:
+        code: make
+`))
+	s.Require().Nil(err)
+	steps := config.PipelinesMap["build"].Steps
+	s.Equal(&RetryConfig{Attempts: 3, Delay: 30 * time.Second, OnExitCodes: []int{1, 128}}, steps[0].Retry)
+	_, ok := steps[0].Data["retry"]
+	s.False(ok)
+	_, ok = steps[0].RawData["retry"]
+	s.False(ok)
+	s.Equal(&RetryConfig{Attempts: 2, Delay: DefaultRetryDelay}, steps[1].Retry)
+	s.Nil(steps[2].Retry)
+
+	invalid := map[string]string{
+		"retry: 3":                               "Step script has an invalid retry",
+		"retry: {delay: 5s}":                     "Step script has a retry without attempts",
+		"retry: {attempts: 0}":                   "Step script has an invalid retry attempts 0",
+		"retry: {attempts: 2, delay: soon}":      "Step script has an invalid retry delay soon",
+		"retry: {attempts: 2, on-exit-codes: 1}": "Step script has an invalid retry on-exit-codes",
+		"retry: {attempts: 2, backoff: 2}":       "Step script has an unknown retry option backoff",
+	}
+	for retry, expected := range invalid {
+		_, err := ConfigFromYaml([]byte(`
+build:
+  steps:
+    - script:
+        code: make
+        ` + retry + `
+`))
+		s.Require().NotNil(err, retry)
+		s.Contains(err.Error(), expected, retry)
+	}
+}
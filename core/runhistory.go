@@ -0,0 +1,208 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RunRecord is what is kept of a local run of a pipeline, under the runs
+// directory of the working dir
+type RunRecord struct {
+	RunID    string `json:"runId"`
+	Pipeline string `json:"pipeline"`
+	// Result is running until the main steps finish, then passed or failed
+	Result string `json:"result"`
+	// AfterStepsResult is passed or failed when after-steps ran
+	AfterStepsResult string     `json:"afterStepsResult,omitempty"`
+	Started          time.Time  `json:"started"`
+	Finished         *time.Time `json:"finished,omitempty"`
+	Git              RunGit     `json:"git"`
+	// WerckerYml is the wercker.yml the run used
+	WerckerYml string        `json:"werckerYml,omitempty"`
+	Steps      []*StepRecord `json:"steps"`
+	// OutputPath is where the output of the run was stored
+	OutputPath string `json:"outputPath,omitempty"`
+	// PID is the process that ran the run, a run that was killed before it
+	// finished is not running anymore
+	PID int `json:"pid,omitempty"`
+}
+
+// RunGit is the git information of a run
+type RunGit struct {
+	Domain     string `json:"domain,omitempty"`
+	Owner      string `json:"owner,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Branch     string `json:"branch,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+}
+
+// StepRecord is a step of a RunRecord
+type StepRecord struct {
+	Order       int        `json:"order"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName"`
+	SafeID      string     `json:"safeId"`
+	Result      string     `json:"result"`
+	ExitCode    int        `json:"exitCode"`
+	Attempts    int        `json:"attempts,omitempty"`
+	Message     string     `json:"message,omitempty"`
+	ArtifactURL string     `json:"artifactUrl,omitempty"`
+	PackageURL  string     `json:"packageUrl,omitempty"`
+	Started     time.Time  `json:"started"`
+	Finished    *time.Time `json:"finished,omitempty"`
+}
+
+// LogRecord is a chunk of the logs of a run, the runs directory keeps one
+// per line in RunLogsFile
+type LogRecord struct {
+	Time time.Time `json:"t"`
+	// Step is the display name of the step that logged, StepName its name
+	Step     string `json:"step,omitempty"`
+	StepName string `json:"name,omitempty"`
+	Stream   string `json:"s"`
+	Logs     string `json:"l"`
+}
+
+// RunLogsFile is the file in the directory of a run its logs are kept in
+const RunLogsFile = "logs.jsonl"
+
+// Running tells whether the run has not finished and its process is still
+// there
+func (r *RunRecord) Running() bool {
+	if r.Finished != nil || r.PID <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(r.PID)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// Duration is how long the run took, or has been running
+func (r *RunRecord) Duration() time.Duration {
+	if r.Finished == nil {
+		return time.Since(r.Started)
+	}
+	return r.Finished.Sub(r.Started)
+}
+
+// Duration is how long the step took, or has been running
+func (s *StepRecord) Duration() time.Duration {
+	if s.Finished == nil {
+		return time.Since(s.Started)
+	}
+	return s.Finished.Sub(s.Started)
+}
+
+// RunsPath returns the directory the runs in workingDir are recorded in
+func RunsPath(workingDir string, s ...string) string {
+	return filepath.Join(append([]string{workingDir, "runs"}, s...)...)
+}
+
+// Save writes the record to the runs directory of workingDir
+func (r *RunRecord) Save(workingDir string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(RunsPath(workingDir, r.RunID), 0755); err != nil {
+		return err
+	}
+	// Write it aside first, `wercker logs --follow` may be reading it
+	path := RunsPath(workingDir, r.RunID, "run.json")
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadRunRecord reads the run id from workingDir, id may be the start of a
+// RunID as long as only one run matches it
+func LoadRunRecord(workingDir, id string) (*RunRecord, error) {
+	if record, err := readRunRecord(workingDir, id); err == nil {
+		return record, nil
+	}
+	records, err := LoadRunRecords(workingDir)
+	if err != nil {
+		return nil, err
+	}
+	var found *RunRecord
+	for _, record := range records {
+		if record.RunID == id {
+			return record, nil
+		}
+		if strings.HasPrefix(record.RunID, id) {
+			if found != nil {
+				return nil, errors.Errorf("more than one run starts with %s", id)
+			}
+			found = record
+		}
+	}
+	if found == nil {
+		return nil, errors.Errorf("no run %s in %s", id, workingDir)
+	}
+	return found, nil
+}
+
+// LoadRunRecords reads every run recorded in workingDir, the latest first
+func LoadRunRecords(workingDir string) ([]*RunRecord, error) {
+	dirs, err := ioutil.ReadDir(RunsPath(workingDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	records := []*RunRecord{}
+	for _, dir := range dirs {
+		record, err := readRunRecord(workingDir, dir.Name())
+		if os.IsNotExist(err) {
+			// Not a run, or one that just started
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Started.After(records[j].Started)
+	})
+	return records, nil
+}
+
+func readRunRecord(workingDir, id string) (*RunRecord, error) {
+	b, err := ioutil.ReadFile(RunsPath(workingDir, id, "run.json"))
+	if err != nil {
+		return nil, err
+	}
+	record := &RunRecord{}
+	if err := json.Unmarshal(b, record); err != nil {
+		return nil, errors.Wrapf(err, "unable to read run %s", id)
+	}
+	return record, nil
+}
@@ -0,0 +1,85 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/wercker/wercker/util"
+)
+
+type RunHistorySuite struct {
+	*util.TestSuite
+}
+
+func TestRunHistorySuite(t *testing.T) {
+	suiteTester := &RunHistorySuite{&util.TestSuite{}}
+	suite.Run(t, suiteTester)
+}
+
+func (s *RunHistorySuite) TestSaveAndLoad() {
+	workingDir := s.WorkingDir()
+
+	records, err := LoadRunRecords(workingDir)
+	s.Nil(err)
+	s.Empty(records)
+
+	started := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	finished := started.Add(90 * time.Second)
+	older := &RunRecord{
+		RunID:    "abc123",
+		Pipeline: "build",
+		Result:   "passed",
+		Started:  started,
+		Finished: &finished,
+		Git:      RunGit{Branch: "master"},
+		Steps: []*StepRecord{
+			{Name: "script", DisplayName: "go test", Result: "passed", Started: started, Finished: &finished},
+		},
+	}
+	newer := &RunRecord{
+		RunID:    "abd456",
+		Pipeline: "deploy",
+		Result:   "running",
+		Started:  started.Add(time.Hour),
+		Steps:    []*StepRecord{},
+	}
+	s.Nil(older.Save(workingDir))
+	s.Nil(newer.Save(workingDir))
+
+	records, err = LoadRunRecords(workingDir)
+	s.Require().Nil(err)
+	s.Require().Len(records, 2)
+	s.Equal("abd456", records[0].RunID)
+	s.Equal("abc123", records[1].RunID)
+	s.Equal("master", records[1].Git.Branch)
+	s.Equal(90*time.Second, records[1].Duration())
+	s.Require().Len(records[1].Steps, 1)
+	s.Equal("go test", records[1].Steps[0].DisplayName)
+
+	record, err := LoadRunRecord(workingDir, "abc")
+	s.Require().Nil(err)
+	s.Equal("abc123", record.RunID)
+
+	_, err = LoadRunRecord(workingDir, "ab")
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "more than one run")
+
+	_, err = LoadRunRecord(workingDir, "xyz")
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "no run xyz")
+}
@@ -0,0 +1,555 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigSchema is the JSON Schema describing wercker.yml. It is printed by
+// `wercker check-config --schema` so editors can use it, and it drives the
+// strict mode of check-config. Only the subset of JSON Schema understood by
+// schemaValidator is used: type, enum, properties, additionalProperties,
+// items, anyOf, required, minProperties, maxProperties and $ref, plus the
+// deprecated and deprecationMessage annotations.
+const ConfigSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://wercker.com/schemas/wercker.yml.json",
+  "title": "wercker.yml",
+  "type": "object",
+  "properties": {
+    "box": {"$ref": "#/definitions/box"},
+    "command-timeout": {"type": "integer", "description": "Timeout in minutes for a single command."},
+    "no-response-timeout": {"type": "integer", "description": "Timeout in minutes without output."},
+    "services": {"type": "array", "items": {"$ref": "#/definitions/box"}},
+    "source-dir": {"type": "string"},
+    "env": {"$ref": "#/definitions/env"},
+    "ignore-file": {"type": "string"},
+    "include": {
+      "description": "Local files or globs, relative to this file, whose pipelines, services, templates and workflows are merged into it.",
+      "anyOf": [{"type": "string"}, {"type": "array", "items": {"type": "string"}}]
+    },
+    "templates": {
+      "type": "object",
+      "description": "Pipelines that are only used through extends.",
+      "additionalProperties": {"$ref": "#/definitions/pipeline"}
+    },
+    "workflows": {"type": "array", "items": {"$ref": "#/definitions/workflow"}}
+  },
+  "additionalProperties": {"$ref": "#/definitions/pipeline"},
+  "definitions": {
+    "box": {
+      "anyOf": [
+        {"type": "string"},
+        {
+          "type": "object",
+          "required": ["id"],
+          "properties": {
+            "id": {"type": "string"},
+            "name": {"type": "string"},
+            "tag": {"type": "string"},
+            "cmd": {"type": "string"},
+            "env": {"type": "object", "additionalProperties": {"$ref": "#/definitions/scalar"}},
+            "ports": {"type": "array", "items": {"type": ["string", "integer"]}},
+            "entrypoint": {"type": "string"},
+            "url": {"type": "string"},
+            "volumes": {"type": "string"},
+            "username": {"type": "string"},
+            "password": {"type": "string"},
+            "registry": {"type": "string"},
+            "aws-registry-id": {"type": ["string", "integer"]},
+            "aws-region": {"type": "string"},
+            "aws-access-key": {"type": "string"},
+            "aws-secret-key": {"type": "string"},
+            "aws-strict-auth": {"type": "boolean"},
+            "azure-client-id": {"type": "string"},
+            "azure-client-secret": {"type": "string"},
+            "azure-subscription-id": {"type": "string"},
+            "azure-tenant-id": {"type": "string"},
+            "azure-resource-group": {"type": "string"},
+            "azure-registry-name": {"type": "string"},
+            "azure-login-server": {"type": "string"}
+          },
+          "additionalProperties": false
+        }
+      ]
+    },
+    "scalar": {"type": ["string", "integer", "boolean", "null"]},
+    "env": {
+      "type": "object",
+      "description": "Environment variables, $VAR references are expanded using the passthru variables.",
+      "additionalProperties": {"$ref": "#/definitions/scalar"}
+    },
+    "pipeline": {
+      "type": ["object", "null"],
+      "properties": {
+        "box": {"$ref": "#/definitions/box"},
+        "services": {"type": "array", "items": {"$ref": "#/definitions/box"}},
+        "steps": {"$ref": "#/definitions/steps"},
+        "after-steps": {"$ref": "#/definitions/steps"},
+        "on-success": {"$ref": "#/definitions/steps", "description": "Steps that run after the after-steps when the steps passed."},
+        "on-failure": {"$ref": "#/definitions/steps", "description": "Steps that run after the after-steps when the steps failed."},
+        "always": {"$ref": "#/definitions/steps", "description": "Steps that run last, whatever the result."},
+        "base-path": {"type": "string"},
+        "docker": {"type": "boolean"},
+        "env": {"$ref": "#/definitions/env"},
+        "timeout": {"type": "integer", "description": "Wall-clock timeout in minutes for the whole pipeline."},
+        "extends": {"type": "string", "description": "Name of a pipeline or template to inherit from."},
+        "merge": {
+          "type": "object",
+          "properties": {
+            "steps": {"$ref": "#/definitions/mergeStrategy"},
+            "after-steps": {"$ref": "#/definitions/mergeStrategy"},
+            "on-success": {"$ref": "#/definitions/mergeStrategy"},
+            "on-failure": {"$ref": "#/definitions/mergeStrategy"},
+            "always": {"$ref": "#/definitions/mergeStrategy"},
+            "services": {"$ref": "#/definitions/mergeStrategy"}
+          },
+          "additionalProperties": false
+        },
+        "matrix": {
+          "type": "object",
+          "properties": {
+            "tags": {"type": "array", "items": {"type": "string"}},
+            "env": {
+              "type": "array",
+              "items": {"type": "object", "additionalProperties": {"$ref": "#/definitions/scalar"}}
+            }
+          },
+          "additionalProperties": false
+        }
+      },
+      "additionalProperties": {
+        "$ref": "#/definitions/steps",
+        "deprecated": true,
+        "deprecationMessage": "deploy targets are deprecated, use a separate pipeline and a workflow instead"
+      }
+    },
+    "mergeStrategy": {"enum": ["append", "prepend", "replace"]},
+    "steps": {"type": "array", "items": {"$ref": "#/definitions/step"}},
+    "step": {
+      "anyOf": [
+        {"type": "string"},
+        {
+          "type": "object",
+          "minProperties": 1,
+          "maxProperties": 1,
+          "properties": {
+            "parallel": {
+              "type": "array",
+              "description": "Steps that run at the same time, each in a shell of its own.",
+              "items": {"$ref": "#/definitions/step"}
+            }
+          },
+          "additionalProperties": {"$ref": "#/definitions/stepData"}
+        },
+        {
+          "type": "object",
+          "minProperties": 2,
+          "additionalProperties": {"$ref": "#/definitions/stepValue"},
+          "deprecated": true,
+          "deprecationMessage": "step properties should be nested under the step name"
+        }
+      ]
+    },
+    "stepData": {
+      "type": "object",
+      "properties": {
+        "name": {"type": "string"},
+        "cwd": {"type": "string"},
+        "checkpoint": {"type": "string"},
+        "when": {"type": ["string", "boolean"], "description": "Condition that must be met for the step to run."},
+        "timeout": {"type": ["integer", "string"], "description": "Command timeout in minutes for this step."},
+        "no-response-timeout": {"type": ["integer", "string"], "description": "Timeout in minutes without output for this step."},
+        "retry": {"$ref": "#/definitions/retry"},
+        "allow-failure": {"type": ["boolean", "string"], "description": "Record a failure of this step as a warning instead of failing the pipeline."},
+        "continue-on-error": {"type": ["boolean", "string"], "description": "Same as allow-failure."}
+      },
+      "additionalProperties": {"$ref": "#/definitions/stepValue"}
+    },
+    "retry": {
+      "type": "object",
+      "description": "Run the step again when it fails.",
+      "required": ["attempts"],
+      "properties": {
+        "attempts": {"type": "integer", "description": "Total number of times the step is run."},
+        "delay": {"type": ["string", "integer"], "description": "Wait before the second attempt, such as 10s, doubled for every later attempt."},
+        "on-exit-codes": {"type": "array", "items": {"type": "integer"}, "description": "Only retry for these exit codes."}
+      },
+      "additionalProperties": false
+    },
+    "stepValue": {"type": ["string", "integer", "number", "boolean", "null", "array", "object"]},
+    "workflow": {
+      "type": "object",
+      "required": ["name", "pipelines"],
+      "properties": {
+        "name": {"type": "string"},
+        "pipelines": {"type": "array", "items": {"$ref": "#/definitions/workflowPipeline"}}
+      },
+      "additionalProperties": false
+    },
+    "workflowPipeline": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "pipelineName": {"type": "string"},
+        "requires": {"type": "array", "items": {"type": "string"}},
+        "artifactPipeline": {"type": "string"},
+        "approval": {"type": "boolean", "description": "Ask for approval before running the pipeline."},
+        "approvalMessage": {"type": "string"},
+        "filters": {
+          "type": "object",
+          "description": "Only run the pipeline, and the pipelines that require it, on matching branches or when matching paths changed.",
+          "properties": {
+            "branches": {"type": "array", "items": {"type": "string"}},
+            "paths": {"type": "array", "items": {"type": "string"}}
+          },
+          "additionalProperties": false
+        }
+      },
+      "additionalProperties": false
+    }
+  }
+}
+`
+
+// schemaNode is a parsed JSON Schema, see ConfigSchema for what is supported
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 interface{}            `json:"type"`
+	Description          string                 `json:"description"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	AnyOf                []*schemaNode          `json:"anyOf"`
+	Required             []string               `json:"required"`
+	MinProperties        *int                   `json:"minProperties"`
+	MaxProperties        *int                   `json:"maxProperties"`
+	Deprecated           bool                   `json:"deprecated"`
+	DeprecationMessage   string                 `json:"deprecationMessage"`
+	Definitions          map[string]*schemaNode `json:"definitions"`
+
+	additional   *schemaNode
+	noAdditional bool
+}
+
+func (n *schemaNode) prepare() error {
+	raw := strings.TrimSpace(string(n.AdditionalProperties))
+	switch raw {
+	case "", "true":
+	case "false":
+		n.noAdditional = true
+	default:
+		n.additional = &schemaNode{}
+		if err := json.Unmarshal(n.AdditionalProperties, n.additional); err != nil {
+			return err
+		}
+	}
+
+	children := []*schemaNode{n.Items, n.additional}
+	children = append(children, n.AnyOf...)
+	for _, child := range n.Properties {
+		children = append(children, child)
+	}
+	for _, child := range n.Definitions {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		if child == nil {
+			continue
+		}
+		if err := child.prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *schemaNode) types() []string {
+	switch t := n.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := []string{}
+		for _, v := range t {
+			types = append(types, fmt.Sprint(v))
+		}
+		return types
+	}
+	return nil
+}
+
+// schemaIssue is a single problem found while validating a document
+type schemaIssue struct {
+	path    yamlPath
+	warning bool
+	message string
+}
+
+// schemaValidator validates the generic form of a yaml document as decoded
+// by yaml.v2 (yaml.MapSlice, []interface{} and scalars) against a schema.
+type schemaValidator struct {
+	root *schemaNode
+}
+
+func newSchemaValidator(schema string) (*schemaValidator, error) {
+	root := &schemaNode{}
+	if err := json.Unmarshal([]byte(schema), root); err != nil {
+		return nil, err
+	}
+	if err := root.prepare(); err != nil {
+		return nil, err
+	}
+	return &schemaValidator{root: root}, nil
+}
+
+func (v *schemaValidator) resolve(n *schemaNode) *schemaNode {
+	for n != nil && n.Ref != "" {
+		name := strings.TrimPrefix(n.Ref, "#/definitions/")
+		ref := v.root.Definitions[name]
+		if ref == nil {
+			return n
+		}
+		if n.Deprecated && !ref.Deprecated {
+			// keep the annotations of the referencing node
+			merged := *ref
+			merged.Deprecated = n.Deprecated
+			merged.DeprecationMessage = n.DeprecationMessage
+			return &merged
+		}
+		n = ref
+	}
+	return n
+}
+
+func (v *schemaValidator) validate(value interface{}, n *schemaNode, path yamlPath) []schemaIssue {
+	n = v.resolve(n)
+	if n == nil {
+		return nil
+	}
+
+	if len(n.AnyOf) > 0 {
+		return v.validateAnyOf(value, n, path)
+	}
+
+	issues := []schemaIssue{}
+	if n.Deprecated {
+		issues = append(issues, schemaIssue{path, true, n.DeprecationMessage})
+	}
+
+	if types := n.types(); len(types) > 0 && !matchesType(value, types) {
+		return append(issues, schemaIssue{path, false, fmt.Sprintf("expected %s but found %s", joinTypes(types), yamlTypeName(value))})
+	}
+
+	if len(n.Enum) > 0 {
+		found := false
+		options := []string{}
+		for _, option := range n.Enum {
+			options = append(options, fmt.Sprint(option))
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			return append(issues, schemaIssue{path, false, fmt.Sprintf("expected one of %s but found %v", strings.Join(options, ", "), value)})
+		}
+	}
+
+	switch val := value.(type) {
+	case yaml.MapSlice:
+		issues = append(issues, v.validateObject(val, n, path)...)
+	case []interface{}:
+		if n.Items != nil {
+			for i, item := range val {
+				issues = append(issues, v.validate(item, n.Items, path.item(i))...)
+			}
+		}
+	}
+	return issues
+}
+
+func (v *schemaValidator) validateObject(val yaml.MapSlice, n *schemaNode, path yamlPath) []schemaIssue {
+	issues := []schemaIssue{}
+	if n.MinProperties != nil && len(val) < *n.MinProperties {
+		issues = append(issues, schemaIssue{path, false, fmt.Sprintf("expected at least %d keys", *n.MinProperties)})
+	}
+	if n.MaxProperties != nil && len(val) > *n.MaxProperties {
+		issues = append(issues, schemaIssue{path, false, fmt.Sprintf("expected at most %d keys", *n.MaxProperties)})
+	}
+
+	seen := map[string]bool{}
+	for _, item := range val {
+		key := fmt.Sprint(item.Key)
+		seen[key] = true
+		childPath := path.child(key)
+
+		if property, ok := n.Properties[key]; ok {
+			issues = append(issues, v.validate(item.Value, property, childPath)...)
+			continue
+		}
+		if n.noAdditional {
+			issues = append(issues, schemaIssue{childPath, false, fmt.Sprintf("unknown key %s%s", key, suggestKey(key, n.Properties))})
+			continue
+		}
+		if n.additional != nil {
+			childIssues := v.validate(item.Value, n.additional, childPath)
+			if hint := suggestKey(key, n.Properties); hint != "" {
+				for i := range childIssues {
+					if len(childIssues[i].path) == len(childPath) {
+						childIssues[i].message += hint
+					}
+				}
+			}
+			issues = append(issues, childIssues...)
+		}
+	}
+
+	for _, required := range n.Required {
+		if !seen[required] {
+			issues = append(issues, schemaIssue{path, false, fmt.Sprintf("missing required key %s", required)})
+		}
+	}
+	return issues
+}
+
+// validateAnyOf uses the first alternative without errors, if none of them
+// fit the errors of the first alternative that has the right type are used.
+func (v *schemaValidator) validateAnyOf(value interface{}, n *schemaNode, path yamlPath) []schemaIssue {
+	var best []schemaIssue
+	types := []string{}
+	for _, alternative := range n.AnyOf {
+		alternative = v.resolve(alternative)
+		issues := v.validate(value, alternative, path)
+		if !hasErrors(issues) {
+			return issues
+		}
+		altTypes := alternative.types()
+		types = append(types, altTypes...)
+		if best == nil && (len(altTypes) == 0 || matchesType(value, altTypes)) {
+			best = issues
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return []schemaIssue{{path, false, fmt.Sprintf("expected %s but found %s", joinTypes(types), yamlTypeName(value))}}
+}
+
+func hasErrors(issues []schemaIssue) bool {
+	for _, issue := range issues {
+		if !issue.warning {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(value interface{}, types []string) bool {
+	actual := yamlTypeName(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func yamlTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int32, int64, uint, uint32, uint64:
+		return "integer"
+	case float32, float64:
+		return "number"
+	case yaml.MapSlice, map[interface{}]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func joinTypes(types []string) string {
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, t := range types {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	if len(unique) == 1 {
+		return unique[0]
+	}
+	return strings.Join(unique[:len(unique)-1], ", ") + " or " + unique[len(unique)-1]
+}
+
+// suggestKey returns a hint about a known key that is spelled similar to key
+func suggestKey(key string, known map[string]*schemaNode) string {
+	candidates := []string{}
+	for k := range known {
+		candidates = append(candidates, k)
+	}
+	sort.Strings(candidates)
+	for _, candidate := range candidates {
+		if editDistance(key, candidate) <= 2 {
+			return fmt.Sprintf(" (did you mean %s?)", candidate)
+		}
+	}
+	return ""
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minOf(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minOf(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -74,6 +74,10 @@ type Session struct {
 	recv       chan string
 	exit       chan int
 	logger     *util.LogEntry
+	// logPrefix is put in front of every line of output, midLine tracks
+	// whether the last output ended without a newline
+	logPrefix string
+	midLine   bool
 }
 
 // NewSession returns a new interactive session to a container.
@@ -121,6 +125,22 @@ func (s *Session) ShowLogs() {
 	s.logsHidden = false
 }
 
+// SetLogPrefix makes the session put prefix in front of every line it emits,
+// so the output of sessions running at the same time can be told apart
+func (s *Session) SetLogPrefix(prefix string) {
+	s.logPrefix = prefix
+}
+
+// prefixLogs adds the log prefix to the start of each line in logs
+func (s *Session) prefixLogs(logs string) string {
+	if s.logPrefix == "" {
+		return logs
+	}
+	prefixed, lineStart := util.PrefixLines(s.logPrefix, logs, !s.midLine)
+	s.midLine = !lineStart
+	return prefixed
+}
+
 // Send an array of commands.
 func (s *Session) Send(sessionCtx context.Context, forceHidden bool, commands ...string) error {
 	e, err := EmitterFromContext(sessionCtx)
@@ -152,13 +172,45 @@ func (s *Session) Send(sessionCtx context.Context, forceHidden bool, commands ..
 			e.Emit(Logs, &LogsArgs{
 				Hidden: hidden,
 				Stream: "stdin",
-				Logs:   command,
+				Logs:   s.prefixLogs(command),
 			})
 		}
 	}
 	return nil
 }
 
+// commandTimeouts override the timeouts from the PipelineOptions for the
+// commands sent with a context, values are in milliseconds
+type commandTimeouts struct {
+	command    int
+	noResponse int
+}
+
+// WithCommandTimeouts returns a context that makes SendChecked use the given
+// timeouts, in milliseconds, instead of the CommandTimeout and
+// NoResponseTimeout from the PipelineOptions. Zero keeps the default.
+func WithCommandTimeouts(ctx context.Context, commandTimeout, noResponseTimeout int) context.Context {
+	return context.WithValue(ctx, "CommandTimeouts", &commandTimeouts{
+		command:    commandTimeout,
+		noResponse: noResponseTimeout,
+	})
+}
+
+// timeouts returns the command and no-response timeouts to use for ctx
+func (s *Session) timeouts(ctx context.Context) (time.Duration, time.Duration) {
+	command := s.options.CommandTimeout
+	noResponse := s.options.NoResponseTimeout
+	if t, ok := ctx.Value("CommandTimeouts").(*commandTimeouts); ok {
+		if t.command > 0 {
+			command = t.command
+		}
+		if t.noResponse > 0 {
+			noResponse = t.noResponse
+		}
+	}
+	return time.Duration(command) * time.Millisecond, time.Duration(noResponse) * time.Millisecond
+}
+
 var randomSentinel = func() string {
 	return uuid.NewRandom().String()
 }
@@ -244,7 +296,8 @@ func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (i
 	recv := []string{}
 	sentinel := randomSentinel()
 
-	sendCtx, _ := context.WithTimeout(sessionCtx, time.Duration(s.options.CommandTimeout)*time.Millisecond)
+	commandTimeout, noResponseTimeout := s.timeouts(sessionCtx)
+	sendCtx, _ := context.WithTimeout(sessionCtx, commandTimeout)
 
 	commandComplete := make(chan CommandResult)
 
@@ -279,13 +332,13 @@ func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (i
 	}()
 
 	// If we don't get a response in a certain amount of time, timeout
-	noResponseTimeout := make(chan struct{})
+	noResponse := make(chan struct{})
 	go func() {
 		for {
 			select {
-			case <-noResponseTimeout:
+			case <-noResponse:
 				continue
-			case <-time.After(time.Duration(s.options.NoResponseTimeout) * time.Millisecond):
+			case <-time.After(noResponseTimeout):
 				stopReading <- struct{}{}
 				errChan <- fmt.Errorf("Command timed out after no response")
 				return
@@ -299,7 +352,7 @@ func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (i
 			select {
 			case line := <-s.recv:
 				// If we found a line reset the NoResponseTimeout timer
-				noResponseTimeout <- struct{}{}
+				noResponse <- struct{}{}
 				lines := smartSplitLines(line, sentinel)
 				for _, subline := range lines {
 					// subline = fmt.Sprintf("%s\n", subline)
@@ -315,7 +368,7 @@ func (s *Session) SendChecked(sessionCtx context.Context, commands ...string) (i
 					}
 					e.Emit(Logs, &LogsArgs{
 						Hidden: s.logsHidden,
-						Logs:   subline,
+						Logs:   s.prefixLogs(subline),
 					})
 					recv = append(recv, subline)
 				}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 	"github.com/wercker/wercker/util"
@@ -213,6 +214,26 @@ func (s *SessionSuite) TestSendCheckedNoResponseTimeout() {
 	s.Equal(0, len(recv))
 }
 
+func (s *SessionSuite) TestSendCheckedTimeoutsFromContext() {
+	opts := fakeSessionOptions()
+	opts.NoResponseTimeout = 60 * 1000
+	sessionCtx, _, session, transport := FakeSession(s.TestSuite, opts)
+
+	go func() {
+		// Just listen and never send anything
+		for {
+			<-transport.inchan
+		}
+	}()
+
+	timer := time.Now()
+	stepCtx := WithCommandTimeouts(sessionCtx, 0, 10)
+	exit, _, err := session.SendChecked(stepCtx, "foo")
+	s.NotNil(err)
+	s.Equal(-1, exit)
+	s.True(time.Since(timer) < 10*time.Second)
+}
+
 func (s *SessionSuite) TestSendCheckedEarlyExit() {
 	sessionCtx, _, session, transport := FakeSession(s.TestSuite, nil)
 
@@ -274,3 +295,13 @@ func (s *SessionSuite) TestSmartSplitLines() {
 	uselessFound, _ := checkLine(uselessLines[0], sentinel)
 	s.Equal(false, uselessFound)
 }
+
+func (s *SessionSuite) TestPrefixLogs() {
+	sess := &Session{}
+	s.Equal("no prefix\n", sess.prefixLogs("no prefix\n"))
+
+	sess.SetLogPrefix("[lint] ")
+	s.Equal("[lint] one\n[lint] two\n", sess.prefixLogs("one\ntwo\n"))
+	s.Equal("[lint] partial", sess.prefixLogs("partial"))
+	s.Equal(" line\n[lint] next", sess.prefixLogs(" line\nnext"))
+}
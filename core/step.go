@@ -25,6 +25,7 @@ import (
 
 	"github.com/pborman/uuid"
 	"github.com/wercker/wercker/api"
+	"github.com/wercker/wercker/steps"
 	"github.com/wercker/wercker/util"
 	"golang.org/x/net/context"
 
@@ -44,10 +45,12 @@ type StepDesc struct {
 // StepDescProperty is the structure of the values in the "properties"
 // section of the config
 type StepDescProperty struct {
-	Name     string
-	Default  string
-	Required bool
-	Type     string
+	Name       string
+	Default    string
+	Required   bool
+	Type       string
+	Enum       []string
+	Deprecated string
 }
 
 // ReadStepDesc reads a file, expecting it to be parsed into a StepDesc.
@@ -78,6 +81,27 @@ func (sc *StepDesc) Defaults() map[string]string {
 	return m
 }
 
+// Validate checks the data given to a step against the properties in the
+// step.yml, using the same rules as publishing a step. Uses of deprecated
+// properties are returned as warnings.
+func (sc *StepDesc) Validate(stepName string, data map[string]string) ([]string, error) {
+	if sc == nil {
+		return nil, nil
+	}
+	properties := []*steps.StepProperty{}
+	for _, v := range sc.Properties {
+		properties = append(properties, &steps.StepProperty{
+			Name:       v.Name,
+			Type:       v.Type,
+			Required:   v.Required,
+			Default:    v.Default,
+			Enum:       v.Enum,
+			Deprecated: v.Deprecated,
+		})
+	}
+	return steps.ValidateStepData(stepName, properties, data)
+}
+
 // Step interface for steps, to be renamed
 type Step interface {
 	// Bunch of getters
@@ -91,6 +115,11 @@ type Step interface {
 	Version() string
 	ShouldSyncEnv() bool
 	Checkpoint() string
+	When() string
+	Timeout() int
+	NoResponseTimeout() int
+	Retry() *RetryConfig
+	AllowFailure() bool
 
 	// Actual methods
 	Fetch() (string, error)
@@ -116,6 +145,13 @@ type BaseStepOptions struct {
 	Version     string
 	Cwd         string
 	Checkpoint  string
+	When        string
+	// Timeout and NoResponseTimeout are in minutes, zero uses the timeouts
+	// from the PipelineOptions
+	Timeout           int
+	NoResponseTimeout int
+	Retry             *RetryConfig
+	AllowFailure      bool
 }
 
 // BaseStep type for extending
@@ -129,19 +165,42 @@ type BaseStep struct {
 	version     string
 	cwd         string
 	checkpoint  string
+	when        string
+
+	timeout           int
+	noResponseTimeout int
+	retry             *RetryConfig
+	allowFailure      bool
+}
+
+// NewBaseStepOptions returns BaseStepOptions holding the settings every step
+// takes from its stepConfig, the caller fills in what identifies the step
+func NewBaseStepOptions(stepConfig *StepConfig) BaseStepOptions {
+	return BaseStepOptions{
+		When:              stepConfig.When,
+		Timeout:           stepConfig.Timeout,
+		NoResponseTimeout: stepConfig.NoResponseTimeout,
+		Retry:             stepConfig.Retry,
+		AllowFailure:      stepConfig.AllowFailure,
+	}
 }
 
 func NewBaseStep(args BaseStepOptions) *BaseStep {
 	return &BaseStep{
-		displayName: args.DisplayName,
-		env:         args.Env,
-		id:          args.ID,
-		name:        args.Name,
-		owner:       args.Owner,
-		safeID:      args.SafeID,
-		version:     args.Version,
-		cwd:         args.Cwd,
-		checkpoint:  args.Checkpoint,
+		displayName:       args.DisplayName,
+		env:               args.Env,
+		id:                args.ID,
+		name:              args.Name,
+		owner:             args.Owner,
+		safeID:            args.SafeID,
+		version:           args.Version,
+		cwd:               args.Cwd,
+		checkpoint:        args.Checkpoint,
+		when:              args.When,
+		timeout:           args.Timeout,
+		noResponseTimeout: args.NoResponseTimeout,
+		retry:             args.Retry,
+		allowFailure:      args.AllowFailure,
 	}
 }
 
@@ -190,6 +249,31 @@ func (s *BaseStep) Checkpoint() string {
 	return s.checkpoint
 }
 
+// When getter, the condition that needs to be met for the step to run
+func (s *BaseStep) When() string {
+	return s.when
+}
+
+// Timeout getter, the command timeout for this step in minutes
+func (s *BaseStep) Timeout() int {
+	return s.timeout
+}
+
+// NoResponseTimeout getter, the no-response timeout for this step in minutes
+func (s *BaseStep) NoResponseTimeout() int {
+	return s.noResponseTimeout
+}
+
+// Retry getter, how the step is retried when it fails, nil if it is not
+func (s *BaseStep) Retry() *RetryConfig {
+	return s.retry
+}
+
+// AllowFailure getter, whether the pipeline continues when this step fails
+func (s *BaseStep) AllowFailure() bool {
+	return s.allowFailure
+}
+
 func (s *BaseStep) Clean() {
 
 }
@@ -267,22 +351,23 @@ func NewStep(stepConfig *StepConfig, options *PipelineOptions) (*ExternalStep, e
 		"SafeID": stepSafeID,
 	})
 
+	baseOptions := NewBaseStepOptions(stepConfig)
+	baseOptions.DisplayName = displayName
+	baseOptions.Env = util.NewEnvironment()
+	baseOptions.ID = identifier
+	baseOptions.Name = name
+	baseOptions.Owner = owner
+	baseOptions.SafeID = stepSafeID
+	baseOptions.Version = version
+	baseOptions.Cwd = stepConfig.Cwd
+	baseOptions.Checkpoint = stepConfig.Checkpoint
+
 	return &ExternalStep{
-		BaseStep: &BaseStep{
-			displayName: displayName,
-			env:         util.NewEnvironment(),
-			id:          identifier,
-			name:        name,
-			owner:       owner,
-			safeID:      stepSafeID,
-			version:     version,
-			cwd:         stepConfig.Cwd,
-			checkpoint:  stepConfig.Checkpoint,
-		},
-		options: options,
-		data:    data,
-		url:     url,
-		logger:  logger,
+		BaseStep: NewBaseStep(baseOptions),
+		options:  options,
+		data:     data,
+		url:      url,
+		logger:   logger,
 	}, nil
 }
 
@@ -429,6 +514,14 @@ func (s *ExternalStep) Fetch() (string, error) {
 	if err == nil {
 		s.stepDesc = desc
 	}
+
+	warnings, err := s.stepDesc.Validate(s.ID(), s.data)
+	for _, warning := range warnings {
+		s.logger.Warnln(warning)
+	}
+	if err != nil {
+		return "", err
+	}
 	return hostStepPath, nil
 }
 
@@ -113,3 +113,52 @@ func (s *StepSuite) TestFetchFileDev() {
 	_, err = step.Fetch()
 	s.Nil(err)
 }
+
+func (s *StepSuite) TestFetchValidatesProperties() {
+	options := DefaultTestPipelineOptions(s.TestSuite, map[string]interface{}{
+		"enable-dev-steps": true,
+	})
+
+	tmpdir, err := ioutil.TempDir("", "wercker")
+	s.Nil(err)
+	defer os.RemoveAll(tmpdir)
+	os.MkdirAll(filepath.Join(options.WorkingDir, "steps"), 0777)
+
+	stepYml := `name: foo
+version: 1.0.0
+properties:
+  - name: url
+    required: true
+  - name: retries
+    type: int
+`
+	err = ioutil.WriteFile(filepath.Join(tmpdir, "step.yml"), []byte(stepYml), 0644)
+	s.Nil(err)
+
+	fileStep := fmt.Sprintf(`foo "file:///%s"`, tmpdir)
+	cfg := &StepConfig{ID: fileStep, Data: map[string]string{"retries": "many"}}
+
+	step, err := NewStep(cfg, options)
+	s.Nil(err)
+	_, err = step.Fetch()
+	s.Require().NotNil(err)
+	s.Contains(err.Error(), "Step foo is missing required property url")
+	s.Contains(err.Error(), "Step foo has an invalid value for property retries")
+}
+
+func (s *StepSuite) TestNewBaseStepOptions() {
+	cfg := &StepConfig{
+		ID:                "script",
+		When:              "$DEPLOY",
+		Timeout:           5,
+		NoResponseTimeout: 2,
+		Retry:             &RetryConfig{Attempts: 3},
+		AllowFailure:      true,
+	}
+	step := NewBaseStep(NewBaseStepOptions(cfg))
+	s.Equal("$DEPLOY", step.When())
+	s.Equal(5, step.Timeout())
+	s.Equal(2, step.NoResponseTimeout())
+	s.Equal(3, step.Retry().Attempts)
+	s.True(step.AllowFailure())
+}
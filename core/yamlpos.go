@@ -0,0 +1,241 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// yamlPosition is a 1-based line and column in a yaml document
+type yamlPosition struct {
+	Line   int
+	Column int
+}
+
+// yamlPath identifies a node in a yaml document, map keys are used as is and
+// sequence items are written as "[n]"
+type yamlPath []string
+
+func (p yamlPath) child(segment string) yamlPath {
+	c := make(yamlPath, len(p), len(p)+1)
+	copy(c, p)
+	return append(c, segment)
+}
+
+func (p yamlPath) item(i int) yamlPath {
+	return p.child(fmt.Sprintf("[%d]", i))
+}
+
+func (p yamlPath) key() string {
+	return strings.Join(p, "\x00")
+}
+
+// String returns a readable form of the path, such as build.steps[0].script
+func (p yamlPath) String() string {
+	s := ""
+	for _, segment := range p {
+		if s != "" && !strings.HasPrefix(segment, "[") {
+			s += "."
+		}
+		s += segment
+	}
+	return s
+}
+
+// yamlPositions maps the nodes of a yaml document to where they start.
+//
+// yaml.v2 does not expose positions, so this is a small line based scanner
+// that understands the block style used by wercker.yml files: nested
+// mappings, sequences (including "- key: value" items), comments and block
+// scalars. Flow style collections are not descended into, lookups for nodes
+// inside them fall back to the closest known parent.
+type yamlPositions map[string]yamlPosition
+
+type yamlFrame struct {
+	indent int
+	path   yamlPath
+	isSeq  bool
+	index  int
+}
+
+func scanYamlPositions(src []byte) yamlPositions {
+	positions, _ := scanYaml(src)
+	return positions
+}
+
+// yamlComments maps the nodes of a yaml document to the full line comments
+// written right above them, comments at the end of the document are kept
+// under the root path.
+type yamlComments map[string][]string
+
+func scanYaml(src []byte) (yamlPositions, yamlComments) {
+	positions := yamlPositions{}
+	comments := yamlComments{}
+	frames := []*yamlFrame{&yamlFrame{indent: -1}}
+
+	var pendingComments []string
+	record := func(path yamlPath, pos yamlPosition) {
+		positions[path.key()] = pos
+		if len(pendingComments) > 0 {
+			comments[path.key()] = pendingComments
+			pendingComments = nil
+		}
+	}
+
+	var pending *yamlFrame
+	blockIndent := -1
+
+	for n, raw := range strings.Split(string(src), "\n") {
+		lineNo := n + 1
+		line := strings.TrimRight(raw, " \t\r")
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+
+		if blockIndent >= 0 {
+			if content == "" || indent > blockIndent {
+				continue
+			}
+			blockIndent = -1
+		}
+		if strings.HasPrefix(content, "#") {
+			pendingComments = append(pendingComments, content)
+			continue
+		}
+		if content == "" || content == "---" || content == "..." {
+			continue
+		}
+
+		isItem := content == "-" || strings.HasPrefix(content, "- ")
+
+		// A key without a value opens a collection if the next line is
+		// indented further, or is a sequence item at the same indentation.
+		if pending != nil {
+			if indent > pending.indent || (indent == pending.indent && isItem) {
+				pending.indent = indent
+				pending.isSeq = isItem
+				frames = append(frames, pending)
+			}
+			pending = nil
+		}
+
+		for len(frames) > 1 {
+			top := frames[len(frames)-1]
+			if top.indent > indent || (top.indent == indent && top.isSeq && !isItem) {
+				frames = frames[:len(frames)-1]
+				continue
+			}
+			break
+		}
+
+		col := indent
+		if isItem {
+			top := frames[len(frames)-1]
+			if !top.isSeq {
+				continue
+			}
+			itemPath := top.path.item(top.index)
+			top.index++
+			record(itemPath, yamlPosition{lineNo, col + 1})
+
+			rest := strings.TrimPrefix(content, "-")
+			content = strings.TrimLeft(rest, " ")
+			col += 1 + len(rest) - len(content)
+			if content == "" {
+				pending = &yamlFrame{indent: indent, path: itemPath}
+				continue
+			}
+			if _, _, ok := splitYamlKey(content); !ok {
+				continue
+			}
+			// The item is a mapping that starts on this line
+			frames = append(frames, &yamlFrame{indent: col, path: itemPath})
+		}
+
+		key, value, ok := splitYamlKey(content)
+		if !ok {
+			continue
+		}
+		top := frames[len(frames)-1]
+		keyPath := top.path.child(key)
+		record(keyPath, yamlPosition{lineNo, col + 1})
+
+		value = stripYamlComment(value)
+		switch {
+		case value == "":
+			pending = &yamlFrame{indent: col, path: keyPath}
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			blockIndent = col
+		}
+	}
+	if len(pendingComments) > 0 {
+		comments[yamlPath(nil).key()] = pendingComments
+	}
+	return positions, comments
+}
+
+// lookup returns the position of path, or of its closest known parent
+func (p yamlPositions) lookup(path yamlPath) (yamlPosition, bool) {
+	for i := len(path); i > 0; i-- {
+		if pos, ok := p[path[:i].key()]; ok {
+			return pos, true
+		}
+	}
+	return yamlPosition{}, false
+}
+
+// splitYamlKey splits "key: value" into its parts
+func splitYamlKey(content string) (string, string, bool) {
+	if strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") {
+		quote := content[:1]
+		end := strings.Index(content[1:], quote)
+		if end < 0 {
+			return "", "", false
+		}
+		key := content[1 : end+1]
+		rest := content[end+2:]
+		if rest == ":" || strings.HasPrefix(rest, ": ") {
+			return key, strings.TrimSpace(rest[1:]), true
+		}
+		return "", "", false
+	}
+	if strings.HasPrefix(content, "{") || strings.HasPrefix(content, "[") {
+		return "", "", false
+	}
+
+	for i := 0; i < len(content); i++ {
+		if content[i] == '#' && i > 0 && content[i-1] == ' ' {
+			break
+		}
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ') {
+			return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYamlComment removes a trailing comment from an unquoted value
+func stripYamlComment(value string) string {
+	if strings.HasPrefix(value, "#") {
+		return ""
+	}
+	if strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'") {
+		return value
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		return strings.TrimSpace(value[:i])
+	}
+	return value
+}
@@ -377,6 +377,15 @@ func exposedPortMaps(dockerHost string, published []string) ([]ExposedPortMap, e
 	return portMap, nil
 }
 
+// ShellCommand is the command the box runs its shell with
+func (b *DockerBox) ShellCommand() ([]string, error) {
+	cmd, err := shlex.Split(b.cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "shell command split failed %s", b.cmd)
+	}
+	return cmd, nil
+}
+
 //RecoverInteractive restarts the box with a terminal attached
 func (b *DockerBox) RecoverInteractive(cwd string, pipeline core.Pipeline, step core.Step) error {
 	// TODO(termie): maybe move the container manipulation outside of here?
@@ -66,6 +66,10 @@ func (b *DockerBuild) InitEnv(ctx context.Context, hostEnv *util.Environment) {
 	env.Update(hostEnv.GetMirror())
 	env.Update(hostEnv.GetPassthru().Ordered())
 	env.Hidden.Update(hostEnv.GetHiddenPassthru().Ordered())
+	public, hidden := b.YamlEnv(hostEnv)
+	env.Update(public)
+	env.Hidden.Update(hidden)
+	env.Update(b.MatrixEnv())
 }
 
 // DockerRepo calculates our repo name
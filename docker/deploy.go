@@ -72,6 +72,10 @@ func (d *DockerDeploy) InitEnv(ctx context.Context, hostEnv *util.Environment) {
 	env.Update(hostEnv.GetMirror())
 	env.Update(hostEnv.GetPassthru().Ordered())
 	env.Hidden.Update(hostEnv.GetHiddenPassthru().Ordered())
+	public, hidden := d.YamlEnv(hostEnv)
+	env.Update(public)
+	env.Hidden.Update(hidden)
+	env.Update(d.MatrixEnv())
 }
 
 // DockerRepo returns the name where we might store this in docker
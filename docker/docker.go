@@ -79,15 +79,15 @@ func NewDockerScratchPushStep(stepConfig *core.StepConfig, options *core.Pipelin
 	// Add a random number to the name to prevent collisions on disk
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
-	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         &util.Environment{},
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
-	})
+	baseOptions := core.NewBaseStepOptions(stepConfig)
+	baseOptions.DisplayName = displayName
+	baseOptions.Env = &util.Environment{}
+	baseOptions.ID = name
+	baseOptions.Name = name
+	baseOptions.Owner = "wercker"
+	baseOptions.SafeID = stepSafeID
+	baseOptions.Version = util.Version()
+	baseStep := core.NewBaseStep(baseOptions)
 
 	dockerPushStep := &DockerPushStep{
 		BaseStep:      baseStep,
@@ -429,15 +429,15 @@ func NewDockerPushStep(stepConfig *core.StepConfig, options *core.PipelineOption
 	// Add a random number to the name to prevent collisions on disk
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
-	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         &util.Environment{},
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
-	})
+	baseOptions := core.NewBaseStepOptions(stepConfig)
+	baseOptions.DisplayName = displayName
+	baseOptions.Env = &util.Environment{}
+	baseOptions.ID = name
+	baseOptions.Name = name
+	baseOptions.Owner = "wercker"
+	baseOptions.SafeID = stepSafeID
+	baseOptions.Version = util.Version()
+	baseStep := core.NewBaseStep(baseOptions)
 
 	return &DockerPushStep{
 		BaseStep:      baseStep,
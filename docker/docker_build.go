@@ -63,15 +63,15 @@ func NewDockerBuildStep(stepConfig *core.StepConfig, options *core.PipelineOptio
 	// Add a random number to the name to prevent collisions on disk
 	stepSafeID := fmt.Sprintf("%s-%s", name, uuid.NewRandom().String())
 
-	baseStep := core.NewBaseStep(core.BaseStepOptions{
-		DisplayName: displayName,
-		Env:         &util.Environment{},
-		ID:          name,
-		Name:        name,
-		Owner:       "wercker",
-		SafeID:      stepSafeID,
-		Version:     util.Version(),
-	})
+	baseOptions := core.NewBaseStepOptions(stepConfig)
+	baseOptions.DisplayName = displayName
+	baseOptions.Env = &util.Environment{}
+	baseOptions.ID = name
+	baseOptions.Name = name
+	baseOptions.Owner = "wercker"
+	baseOptions.SafeID = stepSafeID
+	baseOptions.Version = util.Version()
+	baseStep := core.NewBaseStep(baseOptions)
 
 	return &DockerBuildStep{
 		BaseStep:      baseStep,
@@ -15,7 +15,10 @@
 package dockerlocal
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
 
 	"github.com/wercker/wercker/core"
 	"github.com/wercker/wercker/util"
@@ -102,38 +105,47 @@ func NewDockerPipeline(name string, config *core.Config, options *core.PipelineO
 		}
 	}
 
-	var afterSteps []core.Step
-	for _, stepConfig := range afterStepsConfig {
-		step, err := NewStep(stepConfig.StepConfig, options, dockerOptions)
-		if err != nil {
-			return nil, err
-		}
-		if step != nil {
-			// we can return a nil step if it's internal and EnableDevSteps is
-			// false
-			afterSteps = append(afterSteps, step)
-		}
+	afterSteps, err := newSteps(afterStepsConfig, options, dockerOptions)
+	if err != nil {
+		return nil, err
+	}
+	onSuccessSteps, err := newSteps(pipelineConfig.OnSuccess, options, dockerOptions)
+	if err != nil {
+		return nil, err
+	}
+	onFailureSteps, err := newSteps(pipelineConfig.OnFailure, options, dockerOptions)
+	if err != nil {
+		return nil, err
+	}
+	alwaysSteps, err := newSteps(pipelineConfig.Always, options, dockerOptions)
+	if err != nil {
+		return nil, err
 	}
-	// if we found some valid after steps, prepend init
-	if len(afterSteps) > 0 {
-		initStep, err := core.NewWerckerInitStep(options)
+	// if we found some valid after steps, they need their own init
+	var afterInitStep core.Step
+	if len(afterSteps)+len(onSuccessSteps)+len(onFailureSteps)+len(alwaysSteps) > 0 {
+		afterInitStep, err = core.NewWerckerInitStep(options)
 		if err != nil {
 			return nil, err
 		}
-
-		afterSteps = append([]core.Step{initStep}, afterSteps...)
 	}
 
 	logger := util.RootLogger().WithField("Logger", "Pipeline")
 	base := core.NewBasePipeline(core.BasePipelineOptions{
 		Options:    options,
 		Config:     pipelineConfig.PipelineConfig,
+		GlobalEnv:  config.Env,
 		Env:        util.NewEnvironment(),
 		Box:        box,
 		Services:   services,
 		Steps:      steps,
 		AfterSteps: afterSteps,
 		Logger:     logger,
+
+		AfterInitStep:  afterInitStep,
+		OnSuccessSteps: onSuccessSteps,
+		OnFailureSteps: onFailureSteps,
+		AlwaysSteps:    alwaysSteps,
 	})
 	return &DockerPipeline{BasePipeline: base, options: options, dockerOptions: dockerOptions}, nil
 }
@@ -164,3 +176,54 @@ func (p *DockerPipeline) CollectCache(ctx context.Context, containerID string) e
 	}
 	return nil
 }
+
+// CollectOutputs copies the outputs the steps wrote to WERCKER_OUTPUTS_FILE
+// next to the output of the run, where the pipelines of a workflow that
+// require this one read them from
+func (p *DockerPipeline) CollectOutputs(ctx context.Context, containerID string) error {
+	client, err := NewOfficialDockerClient(p.dockerOptions)
+	if err != nil {
+		return err
+	}
+	dfc := NewDockerFileCollector(client, containerID)
+
+	archive, err := dfc.Collect(ctx, p.options.GuestPath("report", "outputs.env"))
+	if err != nil {
+		if err == util.ErrEmptyTarball {
+			return nil
+		}
+		return err
+	}
+	defer archive.Close()
+
+	var outputs bytes.Buffer
+	err = <-archive.SingleBytes("outputs.env", &outputs)
+	if err != nil {
+		if err == util.ErrEmptyTarball {
+			return nil
+		}
+		return err
+	}
+
+	if err := os.MkdirAll(p.options.HostPath(), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.options.HostPath("outputs.env"), outputs.Bytes(), 0644)
+}
+
+// newSteps creates the steps for a list of step configs
+func newSteps(stepsConfig []*core.RawStepConfig, options *core.PipelineOptions, dockerOptions *Options) ([]core.Step, error) {
+	var steps []core.Step
+	for _, stepConfig := range stepsConfig {
+		step, err := NewStep(stepConfig.StepConfig, options, dockerOptions)
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			// we can return a nil step if it's internal and EnableDevSteps is
+			// false
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
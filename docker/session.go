@@ -15,6 +15,7 @@
 package dockerlocal
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/fsouza/go-dockerclient"
@@ -29,6 +30,9 @@ type DockerTransport struct {
 	client      *DockerClient
 	containerID string
 	logger      *util.LogEntry
+	// execCmd is set for transports that start their own shell in the
+	// container instead of attaching to the one it runs
+	execCmd []string
 }
 
 // NewDockerTransport constructor
@@ -41,9 +45,24 @@ func NewDockerTransport(options *core.PipelineOptions, dockerOptions *Options, c
 	return &DockerTransport{options: options, client: client, containerID: containerID, logger: logger}, nil
 }
 
+// NewDockerExecTransport constructor for a transport that uses docker exec to
+// run cmd, a shell, in the container. Every session using one gets a shell of
+// its own, so they can run commands at the same time.
+func NewDockerExecTransport(options *core.PipelineOptions, dockerOptions *Options, containerID string, cmd []string) (core.Transport, error) {
+	client, err := NewDockerClient(dockerOptions)
+	if err != nil {
+		return nil, err
+	}
+	logger := util.RootLogger().WithField("Logger", "DockerTransport")
+	return &DockerTransport{options: options, client: client, containerID: containerID, logger: logger, execCmd: cmd}, nil
+}
+
 // Attach the given reader and writers to the transport, return a context
 // that will be closed when the transport dies
 func (t *DockerTransport) Attach(sessionCtx context.Context, stdin io.Reader, stdout, stderr io.Writer) (context.Context, error) {
+	if t.execCmd != nil {
+		return t.attachExec(sessionCtx, stdin, stdout, stderr)
+	}
 	t.logger.Debugln("Attaching to container: ", t.containerID)
 	started := make(chan struct{})
 	transportCtx, cancel := context.WithCancel(sessionCtx)
@@ -86,3 +105,46 @@ func (t *DockerTransport) Attach(sessionCtx context.Context, stdin io.Reader, st
 	started <- struct{}{}
 	return transportCtx, nil
 }
+
+// attachExec starts execCmd in the container and attaches to it, the context
+// is closed when the command exits
+func (t *DockerTransport) attachExec(sessionCtx context.Context, stdin io.Reader, stdout, stderr io.Writer) (context.Context, error) {
+	t.logger.Debugln("Starting exec in container: ", t.containerID)
+	exec, err := t.client.CreateExec(docker.CreateExecOptions{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+		Cmd:          t.execCmd,
+		Container:    t.containerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	started := make(chan struct{})
+	transportCtx, cancel := context.WithCancel(sessionCtx)
+	go func() {
+		defer cancel()
+		err := t.client.StartExec(exec.ID, docker.StartExecOptions{
+			InputStream:  stdin,
+			OutputStream: stdout,
+			ErrorStream:  stderr,
+			RawTerminal:  false,
+			Success:      started,
+		})
+		if err != nil {
+			t.logger.Errorln("Error running exec", err)
+		}
+		t.logger.Debugln("Exec finished in container:", t.containerID)
+	}()
+
+	// Wait for attach
+	select {
+	case <-started:
+		started <- struct{}{}
+	case <-transportCtx.Done():
+		return nil, fmt.Errorf("Unable to start exec in container %s", t.containerID)
+	}
+	return transportCtx, nil
+}
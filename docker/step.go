@@ -26,6 +26,9 @@ import (
 )
 
 func NewStep(config *core.StepConfig, options *core.PipelineOptions, dockerOptions *Options) (core.Step, error) {
+	if len(config.Parallel) > 0 {
+		return NewParallelStep(config, options, dockerOptions)
+	}
 	// NOTE(termie) Special case steps are special
 	if config.ID == "internal/docker-push" {
 		return NewDockerPushStep(config, options, dockerOptions)
@@ -66,6 +69,24 @@ func NewStep(config *core.StepConfig, options *core.PipelineOptions, dockerOptio
 	return NewDockerStep(config, options, dockerOptions)
 }
 
+// NewParallelStep creates the steps of a parallel group and the group itself
+func NewParallelStep(config *core.StepConfig, options *core.PipelineOptions, dockerOptions *Options) (core.Step, error) {
+	steps := []core.Step{}
+	for _, stepConfig := range config.Parallel {
+		step, err := NewStep(stepConfig.StepConfig, options, dockerOptions)
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	return core.NewParallelStep(config, steps), nil
+}
+
 // DockerStep is an external step that knows how to fetch artifacts
 type DockerStep struct {
 	*core.ExternalStep
@@ -33,13 +33,16 @@ func NewLiteralLogHandler(options *core.PipelineOptions) (*LiteralLogHandler, er
 		logger.Level = log.InfoLevel
 	}
 
-	return &LiteralLogHandler{l: logger, options: options}, nil
+	return &LiteralLogHandler{l: logger, options: options, lineStart: true}, nil
 }
 
 // A LiteralLogHandler logs all events using Logrus.
 type LiteralLogHandler struct {
 	l       *util.Logger
 	options *core.PipelineOptions
+	// lineStart is set when the next log starts a new line, which gets the
+	// LogPrefix of the pipeline
+	lineStart bool
 }
 
 // Logs will handle the Logs event.
@@ -58,7 +61,11 @@ func (h *LiteralLogHandler) Logs(args *core.LogsArgs) {
 			"Stream": args.Stream,
 		}).Printf("%s %6s %q", shown, args.Stream, args.Logs)
 	} else if h.shouldPrintLog(args) {
-		h.l.Print(args.Logs)
+		logs := args.Logs
+		if h.options.LogPrefix != "" {
+			logs, h.lineStart = util.PrefixLines(util.LogPrefix(h.options.LogPrefix), logs, h.lineStart)
+		}
+		h.l.Print(logs)
 	}
 }
 
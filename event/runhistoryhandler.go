@@ -0,0 +1,220 @@
+//   Copyright © 2016,2018, Oracle and/or its affiliates.  All rights reserved.
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package event
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wercker/wercker/core"
+	"github.com/wercker/wercker/util"
+)
+
+// NewRunHistoryHandler will create a new RunHistoryHandler.
+func NewRunHistoryHandler(options *core.PipelineOptions) (*RunHistoryHandler, error) {
+	logger := util.RootLogger().WithField("Logger", "RunHistory")
+	return &RunHistoryHandler{options: options, logger: logger}, nil
+}
+
+// A RunHistoryHandler records the run in the working dir, so it can be looked
+// at with `wercker runs` once it finished.
+type RunHistoryHandler struct {
+	options *core.PipelineOptions
+	logger  *util.LogEntry
+
+	// Steps running side by side report at the same time
+	mutex  sync.Mutex
+	record *core.RunRecord
+	logs   *json.Encoder
+	file   *os.File
+}
+
+// BuildStarted will handle the BuildStarted event.
+func (h *RunHistoryHandler) BuildStarted(args *core.BuildStartedArgs) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.record = &core.RunRecord{
+		RunID:    h.options.RunID,
+		Pipeline: h.options.Pipeline,
+		Result:   "running",
+		Started:  time.Now(),
+		Steps:    []*core.StepRecord{},
+		PID:      os.Getpid(),
+	}
+	if git := h.options.GitOptions; git != nil {
+		h.record.Git = core.RunGit{
+			Domain:     git.GitDomain,
+			Owner:      git.GitOwner,
+			Repository: git.GitRepository,
+			Branch:     git.GitBranch,
+			Commit:     git.GitCommit,
+		}
+	}
+	h.save()
+
+	file, err := os.Create(core.RunsPath(h.options.WorkingDir, h.options.RunID, core.RunLogsFile))
+	if err != nil {
+		h.logger.WithField("Error", err).Error("Unable to record the logs of the run")
+		return
+	}
+	h.file = file
+	h.logs = json.NewEncoder(file)
+}
+
+// Logs will handle the Logs event.
+func (h *RunHistoryHandler) Logs(args *core.LogsArgs) {
+	if args.Hidden {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.logs == nil {
+		return
+	}
+
+	record := &core.LogRecord{
+		Time:   time.Now(),
+		Stream: args.Stream,
+		Logs:   args.Logs,
+	}
+	if record.Stream == "" {
+		record.Stream = "stdout"
+	}
+	if args.Step != nil {
+		record.Step = args.Step.DisplayName()
+		record.StepName = args.Step.Name()
+	}
+	if err := h.logs.Encode(record); err != nil {
+		h.logger.WithField("Error", err).Error("Unable to record the logs of the run")
+	}
+}
+
+// StepStarted will handle the BuildStepStarted event.
+func (h *RunHistoryHandler) StepStarted(args *core.BuildStepStartedArgs) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.record == nil || args.Step == nil {
+		return
+	}
+	h.record.Steps = append(h.record.Steps, &core.StepRecord{
+		Order:       args.Order,
+		Name:        args.Step.Name(),
+		DisplayName: args.Step.DisplayName(),
+		SafeID:      args.Step.SafeID(),
+		Result:      "running",
+		Started:     time.Now(),
+	})
+	h.save()
+}
+
+// StepFinished will handle the BuildStepFinished event.
+func (h *RunHistoryHandler) StepFinished(args *core.BuildStepFinishedArgs) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.record == nil || args.Step == nil {
+		return
+	}
+	if args.WerckerYamlContents != "" {
+		h.record.WerckerYml = args.WerckerYamlContents
+	}
+
+	// The latest unfinished step with the same id, a step can be used twice
+	var step *core.StepRecord
+	for i := len(h.record.Steps) - 1; i >= 0; i-- {
+		if s := h.record.Steps[i]; s.SafeID == args.Step.SafeID() && s.Finished == nil {
+			step = s
+			break
+		}
+	}
+	if step == nil {
+		return
+	}
+
+	finished := time.Now()
+	step.Finished = &finished
+	switch {
+	case args.Skipped:
+		step.Result = "skipped"
+	case args.Successful:
+		step.Result = "passed"
+	default:
+		step.Result = "failed"
+	}
+	step.ExitCode = args.ExitCode
+	step.Attempts = args.Attempts
+	step.Message = args.Message
+	step.ArtifactURL = args.ArtifactURL
+	step.PackageURL = args.PackageURL
+	h.save()
+}
+
+// BuildFinished will handle the BuildFinished event.
+func (h *RunHistoryHandler) BuildFinished(args *core.BuildFinishedArgs) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.record == nil {
+		return
+	}
+	h.record.Result = args.Result
+	h.save()
+}
+
+// FullPipelineFinished will handle the FullPipelineFinished event, it is the
+// last event of a run.
+func (h *RunHistoryHandler) FullPipelineFinished(args *core.FullPipelineFinishedArgs) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.record == nil {
+		return
+	}
+
+	finished := time.Now()
+	h.record.Finished = &finished
+	if args.RanAfterSteps {
+		h.record.AfterStepsResult = "failed"
+		if args.AfterStepSuccessful {
+			h.record.AfterStepsResult = "passed"
+		}
+	}
+	if found, _ := util.Exists(h.options.HostPath("output")); found {
+		h.record.OutputPath = h.options.HostPath("output")
+	}
+	h.save()
+
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+		h.logs = nil
+	}
+}
+
+func (h *RunHistoryHandler) save() {
+	if err := h.record.Save(h.options.WorkingDir); err != nil {
+		h.logger.WithField("Error", err).Error("Unable to save the run record")
+	}
+}
+
+// ListenTo will add eventhandlers to e.
+func (h *RunHistoryHandler) ListenTo(e *core.NormalizedEmitter) {
+	e.AddListener(core.BuildStarted, h.BuildStarted)
+	e.AddListener(core.BuildFinished, h.BuildFinished)
+	e.AddListener(core.BuildStepStarted, h.StepStarted)
+	e.AddListener(core.BuildStepFinished, h.StepFinished)
+	e.AddListener(core.FullPipelineFinished, h.FullPipelineFinished)
+	e.AddListener(core.Logs, h.Logs)
+}
@@ -36,4 +36,9 @@ type StepProperty struct {
 	Required bool `json:"required,omitempty"`
 	// default property
 	Default string `json:"default,omitempty"`
+	// enum holds the allowed values for properties of type enum
+	Enum []string `json:"enum,omitempty"`
+	// deprecated marks the property as deprecated, either "true" or a message
+	// explaining what to use instead
+	Deprecated string `json:"deprecated,omitempty"`
 }
@@ -16,11 +16,35 @@ package steps
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/blang/semver"
 	"github.com/wercker/wercker/util"
 )
 
+// Property types that can be declared in a step manifest
+const (
+	PropertyTypeString = "string"
+	PropertyTypeInt    = "int"
+	PropertyTypeBool   = "bool"
+	PropertyTypeEnum   = "enum"
+)
+
+// propertyTypeAliases maps the spellings found in existing step manifests
+// to the property types above
+var propertyTypeAliases = map[string]string{
+	"":        PropertyTypeString,
+	"string":  PropertyTypeString,
+	"int":     PropertyTypeInt,
+	"integer": PropertyTypeInt,
+	"bool":    PropertyTypeBool,
+	"boolean": PropertyTypeBool,
+	"enum":    PropertyTypeEnum,
+}
+
 // isSemVer checks if the version adheres to the SemVer specification:
 // http://semver.org/
 func isSemVer(version string) bool {
@@ -45,5 +69,106 @@ func ValidateManifest(manifest *StepManifest) error {
 		e = append(e, errors.New("Version does not appear to be valid semver"))
 	}
 
+	for _, property := range manifest.Properties {
+		if err := ValidateProperty(property); err != nil {
+			e = append(e, err)
+		}
+	}
+
 	return util.SqaushErrors(e)
 }
+
+// ValidateProperty checks that a property declaration has a known type and
+// a default that matches it.
+func ValidateProperty(property *StepProperty) error {
+	if property.Name == "" {
+		return errors.New("Property name cannot be empty")
+	}
+
+	propertyType, ok := propertyTypeAliases[property.Type]
+	if !ok {
+		return fmt.Errorf("Property %s has unknown type %s", property.Name, property.Type)
+	}
+
+	if propertyType == PropertyTypeEnum && len(property.Enum) == 0 {
+		return fmt.Errorf("Property %s is an enum without values", property.Name)
+	}
+
+	if property.Default != "" {
+		if err := ValidatePropertyValue(property, property.Default); err != nil {
+			return fmt.Errorf("Property %s has an invalid default: %s", property.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidatePropertyValue checks that value is valid for the type of property.
+// Properties with an unknown type accept any value.
+func ValidatePropertyValue(property *StepProperty, value string) error {
+	switch propertyTypeAliases[property.Type] {
+	case PropertyTypeInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("expected an int but got %q", value)
+		}
+	case PropertyTypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("expected a bool but got %q", value)
+		}
+	case PropertyTypeEnum:
+		if !util.ContainsString(property.Enum, value) {
+			return fmt.Errorf("expected one of %s but got %q", strings.Join(property.Enum, ", "), value)
+		}
+	}
+	return nil
+}
+
+// ValidateStepData checks the data given to step against the properties the
+// step declares: required properties must be set or have a default, values
+// must match the property type and unknown properties are not allowed. The
+// latter is only checked if the step declares any properties at all.
+//
+// Using deprecated properties is not an error, a warning is returned for each
+// of them instead.
+func ValidateStepData(step string, properties []*StepProperty, data map[string]string) ([]string, error) {
+	var e []error
+	var warnings []string
+
+	declared := make(map[string]*StepProperty)
+	for _, property := range properties {
+		declared[property.Name] = property
+
+		value, ok := data[property.Name]
+		if property.Required && value == "" && property.Default == "" {
+			e = append(e, fmt.Errorf("Step %s is missing required property %s", step, property.Name))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := ValidatePropertyValue(property, value); err != nil {
+			e = append(e, fmt.Errorf("Step %s has an invalid value for property %s: %s", step, property.Name, err))
+		}
+		if property.Deprecated != "" {
+			warning := fmt.Sprintf("Step %s uses deprecated property %s", step, property.Name)
+			if property.Deprecated != "true" {
+				warning += ": " + property.Deprecated
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+
+	if len(properties) > 0 {
+		names := []string{}
+		for name := range data {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := declared[name]; !ok {
+				e = append(e, fmt.Errorf("Step %s has unknown property %s", step, name))
+			}
+		}
+	}
+
+	return warnings, util.SqaushErrors(e)
+}
@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_isSemVer_Valid(t *testing.T) {
@@ -49,3 +50,69 @@ func Test_isSemVer_Invalid(t *testing.T) {
 		assert.False(t, actual, `isSemVer should return false for: "%s"`, version)
 	}
 }
+
+func Test_ValidateProperty(t *testing.T) {
+	valid := []*StepProperty{
+		{Name: "message"},
+		{Name: "retries", Type: "int", Default: "3"},
+		{Name: "verbose", Type: "boolean", Default: "false"},
+		{Name: "level", Type: "enum", Enum: []string{"debug", "info"}, Default: "info"},
+	}
+	for _, property := range valid {
+		assert.NoError(t, ValidateProperty(property), property.Name)
+	}
+
+	invalid := []*StepProperty{
+		{Type: "string"},
+		{Name: "retries", Type: "float"},
+		{Name: "retries", Type: "int", Default: "three"},
+		{Name: "level", Type: "enum"},
+		{Name: "level", Type: "enum", Enum: []string{"debug"}, Default: "info"},
+	}
+	for _, property := range invalid {
+		assert.Error(t, ValidateProperty(property), property.Name)
+	}
+}
+
+func Test_ValidateStepData(t *testing.T) {
+	properties := []*StepProperty{
+		{Name: "url", Required: true},
+		{Name: "retries", Type: "int", Default: "3"},
+		{Name: "verbose", Type: "bool"},
+		{Name: "level", Type: "enum", Enum: []string{"debug", "info"}},
+		{Name: "token", Deprecated: "use url instead"},
+	}
+
+	warnings, err := ValidateStepData("notify", properties, map[string]string{
+		"url":     "http://example.com",
+		"retries": "5",
+		"verbose": "true",
+		"level":   "debug",
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	warnings, err = ValidateStepData("notify", properties, map[string]string{
+		"url":   "http://example.com",
+		"token": "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Step notify uses deprecated property token: use url instead"}, warnings)
+
+	_, err = ValidateStepData("notify", properties, map[string]string{
+		"retries": "many",
+		"verbose": "yes please",
+		"level":   "trace",
+		"colour":  "blue",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Step notify is missing required property url")
+	assert.Contains(t, err.Error(), `Step notify has an invalid value for property retries: expected an int but got "many"`)
+	assert.Contains(t, err.Error(), "Step notify has an invalid value for property verbose")
+	assert.Contains(t, err.Error(), "Step notify has an invalid value for property level: expected one of debug, info")
+	assert.Contains(t, err.Error(), "Step notify has unknown property colour")
+
+	// Steps without declared properties accept anything
+	_, err = ValidateStepData("notify", nil, map[string]string{"colour": "blue"})
+	assert.NoError(t, err)
+}
@@ -160,9 +160,40 @@ func (f *TerseFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	}
 
 	b.WriteByte('\n')
+
+	// Pipelines that run side by side mark their lines with their name
+	if prefix, ok := entry.Data["Prefix"].(string); ok && prefix != "" {
+		prefixed, _ := PrefixLines(LogPrefix(prefix), b.String(), true)
+		return []byte(prefixed), nil
+	}
 	return b.Bytes(), nil
 }
 
+// LogPrefix is what PrefixLines puts in front of the lines of name
+func LogPrefix(name string) string {
+	return fmt.Sprintf("[%s] ", name)
+}
+
+// PrefixLines puts prefix in front of every line in s. lineStart tells if s
+// starts at the beginning of a line, the returned bool tells the same for
+// whatever is written after s.
+func PrefixLines(prefix, s string, lineStart bool) (string, bool) {
+	if s == "" {
+		return s, lineStart
+	}
+	var b bytes.Buffer
+	for i, line := range strings.SplitAfter(s, "\n") {
+		if line == "" {
+			continue
+		}
+		if i > 0 || lineStart {
+			b.WriteString(prefix)
+		}
+		b.WriteString(line)
+	}
+	return b.String(), strings.HasSuffix(s, "\n")
+}
+
 const (
 	nocolor = 0
 	red     = 31
@@ -364,3 +364,13 @@ func UntarTestUtil(dst string, r io.Reader) error {
 		}
 	}
 }
+
+func (s *UtilSuite) TestPrefixLines() {
+	prefixed, lineStart := PrefixLines("[a] ", "one\ntwo", true)
+	s.Equal("[a] one\n[a] two", prefixed)
+	s.False(lineStart)
+
+	prefixed, lineStart = PrefixLines("[a] ", " more\nthree\n", lineStart)
+	s.Equal(" more\n[a] three\n", prefixed)
+	s.True(lineStart)
+}